@@ -0,0 +1,140 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+const (
+	BATCH_WINDOW = 64 /* default commands in flight */
+)
+
+// Batch collects service, dest and laddr commands and pipelines
+// them over the client connection: up to Window calls share the
+// one rpc.Client, whose Go sends each request without waiting for
+// the replies of the previous ones. The commands are independent,
+// dpvs may apply them in any order within the window, so a dest
+// must not share a batch with the add of its own service.
+type Batch struct {
+	Window int
+	Items  []*Batch_item
+
+	c *Client
+}
+
+type Batch_item struct {
+	Args  interface{} /* Vs_service_q, Vs_dest_q or Vs_laddr_q */
+	Reply Vs_cmd_r
+	Err   error
+}
+
+// Batch_error lists the failed items of a batch.
+type Batch_error struct {
+	Total  int
+	Failed []*Batch_item
+}
+
+func (e *Batch_error) Error() string {
+	return fmt.Sprintf("%d of %d commands failed, first: %s",
+		len(e.Failed), e.Total, e.Failed[0].Err)
+}
+
+func (e *Batch_error) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, item := range e.Failed {
+		errs[i] = item.Err
+	}
+	return errs
+}
+
+func (c *Client) NewBatch() *Batch {
+	return &Batch{Window: BATCH_WINDOW, c: c}
+}
+
+func NewBatch() *Batch {
+	return DefaultClient.NewBatch()
+}
+
+func (b *Batch) add(args interface{}) *Batch_item {
+	item := &Batch_item{Args: args}
+	b.Items = append(b.Items, item)
+	return item
+}
+
+// Add_service queues VS_CMD_{NEW,SET,DEL}_SERVICE for o, an invalid
+// scheduler fails the item without sending it.
+func (b *Batch) Add_service(cmd int, o *CmdOptions) *Batch_item {
+	item := b.add(service_q(cmd, o))
+	if cmd != VS_CMD_DEL_SERVICE {
+		item.Err = check_sched(o)
+	}
+	return item
+}
+
+// Add_dest queues VS_CMD_{NEW,SET,DEL}_DEST for o.
+func (b *Batch) Add_dest(cmd int, o *CmdOptions) *Batch_item {
+	return b.add(dest_q(cmd, o))
+}
+
+// Add_laddr queues VS_CMD_{NEW,DEL}_LADDR for o.
+func (b *Batch) Add_laddr(cmd int, o *CmdOptions) *Batch_item {
+	return b.add(laddr_q(cmd, o))
+}
+
+// Run sends all the queued commands and waits for their replies.
+// Every item gets its own Reply and Err, the returned error is a
+// *Batch_error if any of them failed. The items not yet sent when
+// ctx is done fail with its error.
+func (b *Batch) Run(ctx context.Context) error {
+	window := b.Window
+	if window <= 0 {
+		window = 1
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, window)
+	for _, item := range b.Items {
+		if item.Err != nil {
+			continue
+		}
+		/* once ctx is done the rest of the items are not sent */
+		if ctx.Err() != nil {
+			item.Err = ctx_err(ctx)
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			item.Err = ctx_err(ctx)
+			continue
+		}
+		wg.Add(1)
+		go func(item *Batch_item) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			item.Err = b.c.call(ctx, "api", item.Args, &item.Reply)
+		}(item)
+	}
+	wg.Wait()
+
+	var failed []*Batch_item
+	for _, item := range b.Items {
+		if item.Err != nil {
+			failed = append(failed, item)
+		}
+	}
+	if len(failed) > 0 {
+		return &Batch_error{Total: len(b.Items), Failed: failed}
+	}
+	return nil
+}
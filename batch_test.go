@@ -0,0 +1,124 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/yubo/govs"
+	"github.com/yubo/govs/govstest"
+)
+
+// options of the tcp service vip with the dr dest rs, which may be ""
+func options(t *testing.T, vip, rs string, weight int) *govs.CmdOptions {
+	t.Helper()
+	o := &govs.CmdOptions{Protocol: govs.IPPROTO_TCP, Sched_name: "wrr",
+		Weight: weight, Fwd: govs.FWD_DR}
+	if err := o.Addr.Set(vip); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Daddr.Set(rs); err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+func TestBatch(t *testing.T) {
+	ctx := context.Background()
+	c := govstest.NewClient(t)
+	if _, err := c.Set_add(options(t, "10.0.0.1:80", "", 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	b := c.NewBatch()
+	b.Window = 2
+	var ok []*govs.Batch_item
+	for _, rs := range []string{"192.168.1.2:80", "192.168.1.3:80", "192.168.1.4:80"} {
+		ok = append(ok, b.Add_dest(govs.VS_CMD_NEW_DEST, options(t, "10.0.0.1:80", rs, 1)))
+	}
+	if err := b.Run(ctx); err != nil {
+		t.Fatal(err)
+	}
+	for i, item := range ok {
+		if item.Err != nil || item.Reply.Code != 0 {
+			t.Errorf("item %d: %v %+v", i, item.Err, item.Reply)
+		}
+	}
+	if dests, err := c.Get_dests(options(t, "10.0.0.1:80", "", 0)); err != nil || len(dests.Dests) != 3 {
+		t.Errorf("dests %+v, %v, want 3", dests, err)
+	}
+}
+
+// TestBatch_error fails some items of a batch, the others are applied
+func TestBatch_error(t *testing.T) {
+	ctx := context.Background()
+	c := govstest.NewClient(t)
+	if _, err := c.Set_add(options(t, "10.0.0.1:80", "", 0)); err != nil {
+		t.Fatal(err)
+	}
+
+	b := c.NewBatch()
+	added := b.Add_dest(govs.VS_CMD_NEW_DEST, options(t, "10.0.0.1:80", "192.168.1.2:80", 1))
+	no_svc := b.Add_dest(govs.VS_CMD_NEW_DEST, options(t, "10.0.0.2:80", "192.168.1.2:80", 1))
+	exist := b.Add_service(govs.VS_CMD_NEW_SERVICE, options(t, "10.0.0.1:80", "", 0))
+	bad := options(t, "10.0.0.3:80", "", 0)
+	bad.Sched_name = "fastest"
+	bad_sched := b.Add_service(govs.VS_CMD_NEW_SERVICE, bad)
+
+	err := b.Run(ctx)
+	var e *govs.Batch_error
+	if !errors.As(err, &e) {
+		t.Fatalf("err %v, want a *Batch_error", err)
+	}
+	if e.Total != 4 || len(e.Failed) != 3 || e.Failed[0] != no_svc ||
+		e.Failed[1] != exist || e.Failed[2] != bad_sched {
+		t.Errorf("failed %d of %d: %+v", len(e.Failed), e.Total, e.Failed)
+	}
+	if added.Err != nil {
+		t.Errorf("added: %v", added.Err)
+	}
+
+	/* errors.Is sees every failed item */
+	if !errors.Is(err, govs.ErrNotExist) || !errors.Is(err, govs.ErrExist) ||
+		errors.Is(err, govs.ErrInvalid) {
+		t.Errorf("err %v: ErrNotExist %v, ErrExist %v, ErrInvalid %v", err,
+			errors.Is(err, govs.ErrNotExist), errors.Is(err, govs.ErrExist),
+			errors.Is(err, govs.ErrInvalid))
+	}
+	var de *govs.Error
+	if !errors.As(err, &de) || de.Cmd != govs.VS_CMD_NEW_DEST {
+		t.Errorf("errors.As: %+v, want the *Error of the dest", de)
+	}
+	if no_svc.Reply.Code == 0 || bad_sched.Reply.Code != 0 {
+		t.Errorf("replies: %+v, %+v", no_svc.Reply, bad_sched.Reply)
+	}
+
+	if dests, err := c.Get_dests(options(t, "10.0.0.1:80", "", 0)); err != nil || len(dests.Dests) != 1 {
+		t.Errorf("dests %+v, %v, want the added one", dests, err)
+	}
+	if _, err := c.Get_service(bad); !errors.Is(err, govs.ErrNotExist) {
+		t.Errorf("service with a bad scheduler sent, err %v", err)
+	}
+}
+
+func TestBatch_cancel(t *testing.T) {
+	c := govstest.NewClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	b := c.NewBatch()
+	item := b.Add_service(govs.VS_CMD_NEW_SERVICE, options(t, "10.0.0.1:80", "", 0))
+	if err := b.Run(ctx); !errors.Is(err, context.Canceled) || !errors.Is(item.Err, context.Canceled) {
+		t.Errorf("err %v, item %v, want context.Canceled", err, item.Err)
+	}
+	if _, err := c.Get_service(options(t, "10.0.0.1:80", "", 0)); !errors.Is(err, govs.ErrNotExist) {
+		t.Errorf("service sent after cancel, err %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sync"
+	"time"
+)
+
+// Client is a connection to one dpvs instance. A Client is safe
+// for concurrent use by multiple goroutines.
+type Client struct {
+	// Timeout bounds calls whose context has no deadline,
+	// zero means no limit.
+	Timeout time.Duration
+
+	// Backoff is used to redial a broken connection.
+	Backoff Backoff
+
+	mu           sync.Mutex
+	dial         Dialer
+	rpc          *rpc.Client
+	interceptors []Interceptor
+
+	// refused holds the protocols the dpvs on rpc refused to
+	// balance, see Check_protocol
+	refused map[uint8]error
+}
+
+// Dialer opens a new connection to dpvs.
+type Dialer func(ctx context.Context) (net.Conn, error)
+
+// Backoff is an exponential backoff policy. After a failed
+// attempt i the client waits Min*Factor^i, at most Max.
+type Backoff struct {
+	Retries int
+	Min     time.Duration
+	Max     time.Duration
+	Factor  float64
+}
+
+var DefaultBackoff = Backoff{
+	Retries: 5,
+	Min:     100 * time.Millisecond,
+	Max:     5 * time.Second,
+	Factor:  2,
+}
+
+func (b Backoff) delay(i int) time.Duration {
+	d := float64(b.Min)
+	for ; i > 0 && d < float64(b.Max); i-- {
+		d *= b.Factor
+	}
+	if d > float64(b.Max) {
+		return b.Max
+	}
+	return time.Duration(d)
+}
+
+// DefaultClient is used by the package level functions.
+var DefaultClient = NewClient(URL)
+
+// NewClient returns a client for the dpvs endpoint, see
+// Parse_endpoint. The connection is established by Dial or by
+// the first call.
+func NewClient(endpoint string) *Client {
+	dial, err := Endpoint_dialer(endpoint, nil)
+	if err != nil {
+		dial = func(ctx context.Context) (net.Conn, error) {
+			return nil, err
+		}
+	}
+	return NewClientDialer(dial)
+}
+
+// NewClientDialer returns a client which uses dial to connect
+// to dpvs.
+func NewClientDialer(dial Dialer) *Client {
+	return &Client{dial: dial, Backoff: DefaultBackoff}
+}
+
+// Dial connects to dpvs, replacing the current connection if any.
+func (c *Client) Dial() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, err := c.redial(context.Background())
+	return err
+}
+
+// redial must be called with c.mu held.
+func (c *Client) redial(ctx context.Context) (*rpc.Client, error) {
+	conn, err := c.dial(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if c.rpc != nil {
+		c.rpc.Close()
+	}
+	c.rpc = jsonrpc.NewClient(conn)
+	c.refused = nil
+	return c.rpc, nil
+}
+
+func (c *Client) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rpc == nil {
+		return nil
+	}
+	err := c.rpc.Close()
+	c.rpc = nil
+	return err
+}
+
+func (c *Client) conn(ctx context.Context) (*rpc.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.rpc != nil {
+		return c.rpc, nil
+	}
+	return c.redial(ctx)
+}
+
+// reset drops rc if it is still the current connection.
+func (c *Client) reset(rc *rpc.Client) {
+	c.mu.Lock()
+	if c.rpc == rc {
+		c.rpc = nil
+	}
+	c.mu.Unlock()
+	rc.Close()
+}
+
+// call passes the request through the interceptors to invoke.
+func (c *Client) call(ctx context.Context, method string, args interface{}, reply interface{}) error {
+	c.mu.Lock()
+	chain := c.interceptors
+	c.mu.Unlock()
+
+	invoker := c.invoke
+	for i := len(chain) - 1; i >= 0; i-- {
+		invoker = chain[i].wrap(invoker)
+	}
+	return invoker(ctx, method, args, reply)
+}
+
+// invoke sends the request and waits for the reply, a reply with
+// a non zero Code is returned as an *Error. A broken connection
+// is dropped and redialed with c.Backoff; the request is sent
+// again only if it is idempotent or if it never reached dpvs.
+func (c *Client) invoke(ctx context.Context, method string, args interface{}, reply interface{}) error {
+	if _, ok := ctx.Deadline(); !ok && c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+
+	retry := idempotent(method, args)
+	for i := 0; ; i++ {
+		sent, err := c.call_once(ctx, method, args, reply)
+		if err == nil {
+			return reply_error(method, args, reply)
+		}
+		if !broken(err) {
+			return err
+		}
+		if (sent && !retry) || i >= c.Backoff.Retries {
+			return err
+		}
+
+		t := time.NewTimer(c.Backoff.delay(i))
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx_err(ctx)
+		}
+	}
+}
+
+// call_once reports whether the request may have reached dpvs.
+// jsonrpc has no way to cancel a pending request, so an abandoned
+// call closes the connection; the next call redials.
+func (c *Client) call_once(ctx context.Context, method string, args interface{}, reply interface{}) (bool, error) {
+	rc, err := c.conn(ctx)
+	if err != nil {
+		if ctx.Err() != nil {
+			return false, ctx_err(ctx)
+		}
+		return false, err
+	}
+
+	call := rc.Go(method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		if call.Error == rpc.ErrShutdown {
+			c.reset(rc)
+			return false, call.Error
+		}
+		if broken(call.Error) {
+			c.reset(rc)
+		}
+		return true, call.Error
+	case <-ctx.Done():
+		c.reset(rc)
+		// wait for the reader, so that it stops touching reply
+		<-call.Done
+		return true, ctx_err(ctx)
+	}
+}
+
+// ctx_err is ErrTimeout on a deadline, still matching
+// context.DeadlineExceeded with errors.Is
+func ctx_err(ctx context.Context) error {
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("%w: %w", ErrTimeout, ctx.Err())
+	}
+	return ctx.Err()
+}
+
+// broken reports whether err means the connection is unusable.
+func broken(err error) bool {
+	if err == rpc.ErrShutdown || err == io.EOF || err == io.ErrUnexpectedEOF {
+		return true
+	}
+	_, ok := err.(net.Error)
+	return ok
+}
+
+// idempotent reports whether the request only reads dpvs state.
+func idempotent(method string, args interface{}) bool {
+	if method == "stats" {
+		return true
+	}
+
+	switch args_cmd(args) {
+	case VS_CMD_GET_SERVICE, VS_CMD_GET_SERVICES, VS_CMD_GET_DEST,
+		VS_CMD_GET_DAEMON, VS_CMD_GET_CONFIG, VS_CMD_GET_INFO,
+		VS_CMD_GET_LADDR, VS_CMD_GET_STATS:
+		return true
+	}
+	return false
+}
+
+// op_cmd returns the VS_CMD_* of an api request or the VS_STATS_*
+// of a stats request
+func op_cmd(method string, args interface{}) int {
+	if q, ok := args.(Vs_stats_q); ok && method == "stats" {
+		return q.Type
+	}
+	return args_cmd(args)
+}
+
+// op_name names a request, e.g. "new dest" or "stats io"
+func op_name(method string, cmd int) string {
+	if method != "stats" {
+		return Cmd_name(cmd)
+	}
+	if cmd >= 0 && cmd < len(stats_names) {
+		return "stats " + stats_names[cmd]
+	}
+	return "stats"
+}
+
+func args_cmd(args interface{}) int {
+	switch a := args.(type) {
+	case Vs_cmd_q:
+		return a.Cmd
+	case Vs_list_q:
+		return a.Cmd
+	case Vs_timeout_q:
+		return a.Cmd
+	case Vs_service_q:
+		return a.Cmd
+	case Vs_dest_q:
+		return a.Cmd
+	case Vs_laddr_q:
+		return a.Cmd
+	case Vs_daemon_q:
+		return a.Cmd
+	}
+	return VS_CMD_UNSPEC
+}
@@ -0,0 +1,118 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+
+	"github.com/yubo/gotool/flags"
+	"github.com/yubo/govs"
+)
+
+var apply_opt struct {
+	file   string
+	atomic bool
+	plan   bool
+	json   bool
+	prune  bool
+}
+
+var diff_opt struct {
+	file  string
+	json  bool
+	prune bool
+}
+
+func init() {
+	cmd := flags.NewCommand("apply", "apply -f file, make dpvs match a yaml/json config",
+		apply_handle, flag.ExitOnError)
+	cmd.StringVar(&apply_opt.file, "f", "", "yaml or json config of the services, dests and laddrs")
+	cmd.BoolVar(&apply_opt.atomic, "atomic", false, "apply one command at a time and roll back on failure")
+	cmd.BoolVar(&apply_opt.plan, "plan", false, "print the plan and exit, same as diff")
+	cmd.BoolVar(&apply_opt.json, "json", false, "print the plan in json")
+	cmd.BoolVar(&apply_opt.prune, "prune", false, "delete the services which are not in the config")
+
+	cmd = flags.NewCommand("diff", "diff -f file, print what apply would change, exit 1 on drift",
+		diff_handle, flag.ExitOnError)
+	cmd.StringVar(&diff_opt.file, "f", "", "yaml or json config of the services, dests and laddrs")
+	cmd.BoolVar(&diff_opt.json, "json", false, "print the plan in json")
+	cmd.BoolVar(&diff_opt.prune, "prune", false, "count the services which are not in the config as drift")
+}
+
+// load_plan exits 2 like diff(1) on trouble
+func load_plan(name, file string, prune bool) *govs.Plan {
+	if file == "" {
+		fmt.Printf("%s: -f is required\n", name)
+		exit(2)
+	}
+
+	cfg, err := govs.Load_config(file)
+	if err != nil {
+		fmt.Println(err)
+		exit(2)
+	}
+
+	plan, err := govs.Plan_config(context.Background(), cfg, prune)
+	if err != nil {
+		fmt.Println(err)
+		exit(2)
+	}
+	return plan
+}
+
+func print_plan(plan *govs.Plan, as_json bool) {
+	if as_json {
+		buf, err := json.MarshalIndent(plan, "", "  ")
+		if err != nil {
+			fmt.Println(err)
+			exit(2)
+		}
+		fmt.Println(string(buf))
+		return
+	}
+	if !plan.Drift() {
+		fmt.Println("no changes")
+		return
+	}
+	add, edit, del := plan.Count()
+	fmt.Println(plan)
+	fmt.Printf("%d to add, %d to edit, %d to delete\n", add, edit, del)
+}
+
+// diff_plan prints the plan, exit 1 if dpvs drifted from the config
+func diff_plan(plan *govs.Plan, as_json bool) {
+	print_plan(plan, as_json)
+	if plan.Drift() {
+		exit(1)
+	}
+}
+
+func diff_handle(arg interface{}) {
+	diff_plan(load_plan("diff", diff_opt.file, diff_opt.prune), diff_opt.json)
+}
+
+func apply_handle(arg interface{}) {
+	plan := load_plan("apply", apply_opt.file, apply_opt.prune)
+	if apply_opt.plan {
+		diff_plan(plan, apply_opt.json)
+		return
+	}
+
+	print_plan(plan, apply_opt.json)
+	if !plan.Drift() {
+		return
+	}
+	if err := govs.Apply(context.Background(), plan, apply_opt.atomic); err != nil {
+		fmt.Println(err)
+		exit(1)
+	}
+	fmt.Printf("done, %d changes\n", len(plan.Ops))
+}
@@ -0,0 +1,129 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/yubo/govs"
+)
+
+const (
+	ENV_SOCKET = "GOVS_SOCKET"
+)
+
+var (
+	socket   string
+	tls_ca   string
+	tls_cert string
+	tls_key  string
+	// later files override earlier ones
+	config_files = []string{"/etc/govs.conf", "~/.govs.yaml"}
+)
+
+func init() {
+	flag.StringVar(&socket, "socket", "",
+		fmt.Sprintf("dpvs endpoint (default $%s, %s or %s)",
+			ENV_SOCKET, strings.Join(config_files, ", "), govs.URL))
+	flag.StringVar(&tls_ca, "tls_ca", "", "CA file to verify a tls:// endpoint")
+	flag.StringVar(&tls_cert, "tls_cert", "", "client certificate file for a tls:// endpoint")
+	flag.StringVar(&tls_key, "tls_key", "", "client key file for a tls:// endpoint")
+}
+
+/*
+ * config file, one "key: value" per line, '#' starts a comment
+ *
+ *   socket: tls://10.0.0.1:6000
+ *   tls_ca: /etc/govs/ca.pem
+ *   tls_cert: /etc/govs/client.pem
+ *   tls_key: /etc/govs/client.key
+ */
+func load_config(files []string) (map[string]string, error) {
+	conf := make(map[string]string)
+
+	for _, file := range files {
+		if strings.HasPrefix(file, "~/") {
+			home, err := os.UserHomeDir()
+			if err != nil {
+				continue
+			}
+			file = filepath.Join(home, file[2:])
+		}
+
+		f, err := os.Open(file)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		scanner := bufio.NewScanner(f)
+		for n := 1; scanner.Scan(); n++ {
+			line := scanner.Text()
+			if i := strings.Index(line, "#"); i >= 0 {
+				line = line[:i]
+			}
+			if line = strings.TrimSpace(line); line == "" {
+				continue
+			}
+
+			i := strings.IndexAny(line, ":=")
+			if i < 0 {
+				f.Close()
+				return nil, fmt.Errorf("%s:%d: expect 'key: value'", file, n)
+			}
+			conf[strings.TrimSpace(line[:i])] =
+				strings.Trim(strings.TrimSpace(line[i+1:]), `"'`)
+		}
+		f.Close()
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return conf, nil
+}
+
+// endpoint resolves the dpvs endpoint and its tls settings, in
+// order of precedence: flags, $GOVS_SOCKET, config files, govs.URL
+func endpoint() (string, *tls.Config, error) {
+	conf, err := load_config(config_files)
+	if err != nil {
+		return "", nil, err
+	}
+
+	ep := first(socket, os.Getenv(ENV_SOCKET), conf["socket"], govs.URL)
+	network, _, err := govs.Parse_endpoint(ep)
+	if err != nil {
+		return "", nil, err
+	}
+	if network != "tls" {
+		return ep, nil, nil
+	}
+
+	config, err := govs.Tls_config(first(tls_ca, conf["tls_ca"]),
+		first(tls_cert, conf["tls_cert"]), first(tls_key, conf["tls_key"]))
+	if err != nil {
+		return "", nil, err
+	}
+	return ep, config, nil
+}
+
+func first(s ...string) string {
+	for _, v := range s {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
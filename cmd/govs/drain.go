@@ -0,0 +1,65 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/yubo/gotool/flags"
+	"github.com/yubo/govs"
+)
+
+var drain_opt govs.Drain_options
+
+func init() {
+	cmd := flags.NewCommand("drain", "drain -t|u|s|icmp|any vip:port -dest rs:port, stop new connections to a real server and wait for the old ones",
+		drain_handle, flag.ExitOnError)
+	cmd.StringVar(&govs.CmdOpt.TCP, "t", "", "tcp service")
+	cmd.StringVar(&govs.CmdOpt.UDP, "u", "", "udp service")
+	cmd.StringVar(&govs.CmdOpt.SCTP, "s", "", "sctp service")
+	cmd.StringVar(&govs.CmdOpt.ICMP, "icmp", "", "icmp/icmpv6 service")
+	cmd.StringVar(&govs.CmdOpt.ANY, "any", "", "all protocols service")
+	cmd.Var(&govs.CmdOpt.Daddr, "dest", "real-server-address is host[:port] or [ipv6][:port]")
+	cmd.DurationVar(&drain_opt.Timeout, "timeout", 10*time.Minute, "give up after this long, 0 waits forever")
+	cmd.DurationVar(&drain_opt.Interval, "interval", govs.DRAIN_INTERVAL, "time between two polls")
+	cmd.BoolVar(&drain_opt.Inactive, "inact", false, "wait for the inactive connections too")
+	cmd.BoolVar(&drain_opt.Persistent, "persistent", false, "wait for the persistence templates too")
+	cmd.BoolVar(&drain_opt.Delete, "delete", false, "delete the real server once drained")
+}
+
+func drain_progress(d *govs.Vs_dest_user_r, elapsed time.Duration) {
+	fmt.Printf("%s %s active %d inactive %d persistent %d\n",
+		elapsed.Truncate(time.Second), d.Address(),
+		d.Activeconns, d.Inactconns, d.Persistent)
+}
+
+func drain_handle(arg interface{}) {
+	opt := arg.(*govs.CallOptions)
+	if err := govs.Parse_service(opt); err != nil {
+		fmt.Println(err)
+		exit(1)
+	}
+	o := &opt.Opt
+	if o.Addr.Is_zero() || o.Daddr.Is_zero() {
+		fmt.Println("usage: drain -t|u|s|icmp|any vip:port -dest rs:port [-timeout 10m] [-inact] [-persistent] [-delete]")
+		exit(2)
+	}
+
+	drain_opt.Progress = drain_progress
+	if _, err := govs.Drain_dest(o, &drain_opt); err != nil {
+		fmt.Println(err)
+		exit(1)
+	}
+	if drain_opt.Delete {
+		fmt.Printf("%s drained and deleted\n", o.Daddr)
+	} else {
+		fmt.Printf("%s drained\n", o.Daddr)
+	}
+}
@@ -8,14 +8,21 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/yubo/gotool/flags"
 	"github.com/yubo/govs"
 )
 
+// slow start of an added or edited dest
+var dest_ramp time.Duration
+
 func init() {
 	flags.CommandLine.Usage = fmt.Sprintf("Usage: %s COMMAND [OPTIONS] host[:port]\n\n",
 		os.Args[0])
@@ -35,62 +42,92 @@ func init() {
 	cmd = flags.NewCommand("zero", "zero conters in Service/all", zero_handle, flag.ExitOnError)
 	cmd.StringVar(&govs.CmdOpt.TCP, "t", "", "tcp service")
 	cmd.StringVar(&govs.CmdOpt.UDP, "u", "", "udp service")
+	cmd.StringVar(&govs.CmdOpt.SCTP, "s", "", "sctp service")
+	cmd.StringVar(&govs.CmdOpt.ICMP, "icmp", "", "icmp/icmpv6 service")
+	cmd.StringVar(&govs.CmdOpt.ANY, "any", "", "all protocols service")
+
+	// sched
+	flags.NewCommand("sched", "sched list, show the schedulers", sched_handle, flag.ExitOnError)
+
+	// sync
+	cmd = flags.NewCommand("sync", "sync start|stop|status, the connection sync daemons", sync_handle, flag.ExitOnError)
+	cmd.Var(&govs.CmdOpt.Sync_state, "state", "master or backup")
+	cmd.StringVar(&govs.CmdOpt.Mcast_ifn, "ifn", "", "multicast interface of the daemon, e.g. eth0")
+	cmd.IntVar(&govs.CmdOpt.Syncid, "syncid", 0, "sync id 0-255, shared by a master and its backups")
 
 	// timeout
 	cmd = flags.NewCommand("timeout", "show/set timeout", timeout_handle, flag.ExitOnError)
 	cmd.StringVar(&govs.CmdOpt.Timeout_s, "set", "", "set <tcp,tcp_fin,udp>")
 
 	// list
-	cmd = flags.NewCommand("list", "list -t|u host:[port]", list_handle, flag.ExitOnError)
+	cmd = flags.NewCommand("list", "list -t|u|s|icmp|any host:[port]", list_handle, flag.ExitOnError)
 	cmd.StringVar(&govs.CmdOpt.TCP, "t", "", "tcp service")
 	cmd.StringVar(&govs.CmdOpt.UDP, "u", "", "udp service")
+	cmd.StringVar(&govs.CmdOpt.SCTP, "s", "", "sctp service")
+	cmd.StringVar(&govs.CmdOpt.ICMP, "icmp", "", "icmp/icmpv6 service")
+	cmd.StringVar(&govs.CmdOpt.ANY, "any", "", "all protocols service")
 	cmd.BoolVar(&govs.CmdOpt.L, "G", false, "get local address")
 
 	// add
 	cmd = flags.NewCommand("add", "add vs/rs/laddr", add_handle, flag.ExitOnError)
 	cmd.StringVar(&govs.CmdOpt.TCP, "t", "", "tcp service")
 	cmd.StringVar(&govs.CmdOpt.UDP, "u", "", "udp service")
+	cmd.StringVar(&govs.CmdOpt.SCTP, "s", "", "sctp service")
+	cmd.StringVar(&govs.CmdOpt.ICMP, "icmp", "", "icmp/icmpv6 service")
+	cmd.StringVar(&govs.CmdOpt.ANY, "any", "", "all protocols service")
 	cmd.Var(&govs.CmdOpt.Netmask, "m", "netmask default 0.0.0.0")
-	cmd.StringVar(&govs.CmdOpt.Sched_name, "sched", "rr", "the service sched name rr/wrr")
-	cmd.UintVar(&govs.CmdOpt.Flags, "flags", 0, "the service flags")
+	cmd.StringVar(&govs.CmdOpt.Sched_name, "sched", "rr", "the service sched name, see govs sched list")
+	cmd.Var(&govs.CmdOpt.Sched_opts, "sched_opts", "scheduler options, e.g. sh-fallback,sh-port or mh-table=65537")
+	cmd.Var(&govs.CmdOpt.Flags, "flags", "the service flags persistent,onepacket,synproxy,dsnat")
 
 	// adddest
-	cmd.Var(&govs.CmdOpt.Daddr, "dest", "service-address is host[:port]")
-	cmd.UintVar(&govs.CmdOpt.Conn_flags, "conn_flags", 0, "the conn flags")
+	cmd.Var(&govs.CmdOpt.Daddr, "dest", "real-server-address is host[:port] or [ipv6][:port]")
+	cmd.Var(&govs.CmdOpt.Conn_flags, "conn_flags", "the conn flags, e.g. synproxy,dsnat")
+	cmd.Var(&govs.CmdOpt.Fwd, "fwd", "forwarding method fullnat|dr|tunnel|nat|dsnat (default fullnat)")
 	cmd.IntVar(&govs.CmdOpt.Weight, "weight", 0, "capacity of real server")
 	cmd.UintVar(&govs.CmdOpt.U_threshold, "x", 0, "upper threshold of connections")
 	cmd.UintVar(&govs.CmdOpt.L_threshold, "y", 0, "lower threshold of connections")
+	cmd.DurationVar(&dest_ramp, "ramp", 0, "raise the weight from 1 to -weight over this long, e.g. 5m")
 	// addladdr
-	cmd.Var(&govs.CmdOpt.Lip, "laddr", "local-address is host")
+	cmd.Var(&govs.CmdOpt.Lip, "laddr", "local-address is ipv4 or ipv6 host")
 
 	// edit
 	cmd = flags.NewCommand("edit", "edit vs/rs/laddr", edit_handle, flag.ExitOnError)
 	cmd.StringVar(&govs.CmdOpt.TCP, "t", "", "tcp service")
 	cmd.StringVar(&govs.CmdOpt.UDP, "u", "", "udp service")
-	cmd.StringVar(&govs.CmdOpt.Sched_name, "sched", "rr", "the service sched name")
-	cmd.UintVar(&govs.CmdOpt.Flags, "flags", 0, "the service flags")
+	cmd.StringVar(&govs.CmdOpt.SCTP, "s", "", "sctp service")
+	cmd.StringVar(&govs.CmdOpt.ICMP, "icmp", "", "icmp/icmpv6 service")
+	cmd.StringVar(&govs.CmdOpt.ANY, "any", "", "all protocols service")
+	cmd.StringVar(&govs.CmdOpt.Sched_name, "sched", "rr", "the service sched name, see govs sched list")
+	cmd.Var(&govs.CmdOpt.Sched_opts, "sched_opts", "scheduler options, e.g. sh-fallback,sh-port or mh-table=65537")
+	cmd.Var(&govs.CmdOpt.Flags, "flags", "the service flags persistent,onepacket,synproxy,dsnat")
 
 	// editdest
-	cmd.Var(&govs.CmdOpt.Daddr, "dest", "service-address is host[:port]")
-	cmd.UintVar(&govs.CmdOpt.Conn_flags, "conn_flags", 0, "the conn flags")
+	cmd.Var(&govs.CmdOpt.Daddr, "dest", "real-server-address is host[:port] or [ipv6][:port]")
+	cmd.Var(&govs.CmdOpt.Conn_flags, "conn_flags", "the conn flags, e.g. synproxy,dsnat")
+	cmd.Var(&govs.CmdOpt.Fwd, "fwd", "forwarding method fullnat|dr|tunnel|nat|dsnat (default the method of the dest)")
 	cmd.IntVar(&govs.CmdOpt.Weight, "weight", 0, "capacity of real server")
 	cmd.UintVar(&govs.CmdOpt.U_threshold, "x", 0, "upper threshold of connections")
 	cmd.UintVar(&govs.CmdOpt.L_threshold, "y", 0, "lower threshold of connections")
+	cmd.DurationVar(&dest_ramp, "ramp", 0, "raise the weight from 1 to -weight over this long, e.g. 5m")
 	// editladdr
-	cmd.Var(&govs.CmdOpt.Lip, "laddr", "local-address is host")
+	cmd.Var(&govs.CmdOpt.Lip, "laddr", "local-address is ipv4 or ipv6 host")
 
 	// del
 	cmd = flags.NewCommand("del", "del vs/rs/laddr", del_handle, flag.ExitOnError)
 	cmd.StringVar(&govs.CmdOpt.TCP, "t", "", "tcp service")
 	cmd.StringVar(&govs.CmdOpt.UDP, "u", "", "udp service")
+	cmd.StringVar(&govs.CmdOpt.SCTP, "s", "", "sctp service")
+	cmd.StringVar(&govs.CmdOpt.ICMP, "icmp", "", "icmp/icmpv6 service")
+	cmd.StringVar(&govs.CmdOpt.ANY, "any", "", "all protocols service")
 	// deldest
-	cmd.Var(&govs.CmdOpt.Daddr, "dest", "service-address is host[:port]")
+	cmd.Var(&govs.CmdOpt.Daddr, "dest", "real-server-address is host[:port] or [ipv6][:port]")
 	// delladdr
-	cmd.Var(&govs.CmdOpt.Lip, "laddr", "local-address is host")
+	cmd.Var(&govs.CmdOpt.Lip, "laddr", "local-address is ipv4 or ipv6 host")
 }
 
 func version_handle(arg interface{}) {
-	if err, version := govs.Get_version(); err != nil {
+	if version, err := govs.Get_version(); err != nil {
 		fmt.Println(err)
 	} else {
 		fmt.Println(version)
@@ -98,7 +135,7 @@ func version_handle(arg interface{}) {
 }
 
 func info_handle(arg interface{}) {
-	if err, info := govs.Get_version(); err != nil {
+	if info, err := govs.Get_version(); err != nil {
 		fmt.Println(err)
 	} else {
 		fmt.Println(info)
@@ -124,16 +161,41 @@ func timeout_handle(arg interface{}) {
 	}
 }
 
-func list_svc_handle(o *govs.CmdOptions) {
+func sync_handle(arg interface{}) {
+	opt := arg.(*govs.CallOptions)
+	verb(opt)
+	o := &opt.Opt
 
-	ret, err := govs.Get_service(o)
+	if len(opt.Args) != 1 {
+		fmt.Println("usage: sync start -state master|backup -ifn eth0 [-syncid N] | stop -state master|backup | status")
+		return
+	}
+
+	var reply fmt.Stringer
+	var err error
+	switch opt.Args[0] {
+	case "start":
+		reply, err = govs.Start_sync_daemon(o)
+	case "stop":
+		reply, err = govs.Stop_sync_daemon(o)
+	case "status":
+		reply, err = govs.Get_sync_daemon()
+	default:
+		fmt.Printf("sync: unknown command %s, expect start, stop or status\n", opt.Args[0])
+		return
+	}
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
+	fmt.Println(reply)
+}
 
-	if ret.Code != 0 {
-		fmt.Println(ret.Msg)
+func list_svc_handle(o *govs.CmdOptions) {
+
+	ret, err := govs.Get_service(o)
+	if err != nil {
+		fmt.Println(err)
 		return
 	}
 
@@ -166,17 +228,11 @@ func list_svc_handle(o *govs.CmdOptions) {
 func list_svcs_handle(o *govs.CmdOptions) {
 
 	ret, err := govs.Get_services(o)
-
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
 
-	if ret.Code != 0 {
-		fmt.Println(ret.Msg)
-		return
-	}
-
 	fmt.Println(govs.Svc_title())
 	if !o.L {
 		fmt.Println(govs.Dest_title())
@@ -186,26 +242,27 @@ func list_svcs_handle(o *govs.CmdOptions) {
 
 	for _, svc := range ret.Services {
 		fmt.Println(svc)
-		o.Addr.Ip = svc.Addr
-		o.Addr.Port = svc.Port
+		o.Addr = svc.Address()
 		o.Protocol = govs.Protocol(svc.Protocol)
 
 		if !o.L {
 			dests, err := govs.Get_dests(o)
-			if err != nil || dests.Code != 0 ||
-				len(dests.Dests) == 0 {
-				//fmt.Println(err)
+			if err != nil {
+				fmt.Println(err)
 				continue
 			}
-			fmt.Println(dests)
+			if len(dests.Dests) > 0 {
+				fmt.Println(dests)
+			}
 		} else {
 			laddrs, err := govs.Get_laddrs(o)
-			if err != nil || laddrs.Code != 0 ||
-				len(laddrs.Laddrs) == 0 {
-				//fmt.Println(err)
-				return
+			if err != nil {
+				fmt.Println(err)
+				continue
+			}
+			if len(laddrs.Laddrs) > 0 {
+				fmt.Println(laddrs)
 			}
-			fmt.Println(laddrs)
 		}
 	}
 
@@ -216,7 +273,7 @@ func list_handle(arg interface{}) {
 	govs.Parse_service(opt)
 	o := &opt.Opt
 
-	if o.Addr.Ip != 0 {
+	if !o.Addr.Is_zero() {
 		list_svc_handle(o)
 		return
 	}
@@ -224,6 +281,20 @@ func list_handle(arg interface{}) {
 	list_svcs_handle(o)
 }
 
+func sched_handle(arg interface{}) {
+	opt := arg.(*govs.CallOptions)
+	if len(opt.Args) != 1 || opt.Args[0] != "list" {
+		fmt.Println("usage: sched list")
+		return
+	}
+
+	fmt.Printf("%-6s %-8s %-36s %s\n", "Name", "Aliases", "Options", "Description")
+	for _, s := range govs.Schedulers() {
+		fmt.Printf("%-6s %-8s %-36s %s\n", s.Name,
+			strings.Join(s.Aliases, ","), s.Options(), s.Desc)
+	}
+}
+
 func flush_handle(arg interface{}) {
 	if reply, err := govs.Set_flush(nil); err != nil {
 		fmt.Println(err)
@@ -255,9 +326,17 @@ func add_handle(arg interface{}) {
 	}
 	o := &opt.Opt
 
-	if o.Lip != 0 {
+	if !o.Lip.Is_zero() {
 		reply, err = govs.Set_addladdr(o)
-	} else if o.Daddr.Ip != 0 {
+	} else if !o.Daddr.Is_zero() {
+		if err := check_laddrs(o, false); err != nil {
+			fmt.Println(err)
+			return
+		}
+		if dest_ramp > 0 {
+			ramp_dest(o, govs.Set_adddest_ramp)
+			return
+		}
 		reply, err = govs.Set_adddest(o)
 	} else {
 		reply, err = govs.Set_add(o)
@@ -270,6 +349,50 @@ func add_handle(arg interface{}) {
 	}
 }
 
+// check_laddrs refuses a FULLNAT dest of a service without local
+// addresses before it is sent, the edit of a dest which is FULLNAT
+// already or keeps its method goes through
+func check_laddrs(o *govs.CmdOptions, edit bool) error {
+	if edit {
+		if o.Fwd == govs.FWD_UNSET && o.Conn_flags&govs.VS_CONN_F_FWD_MASK == 0 {
+			return nil
+		}
+		dests, err := govs.Get_dests(o)
+		if err != nil {
+			return err
+		}
+		for _, d := range dests.Dests {
+			if fwd, _ := govs.Conn_fwd(d.Conn_flags); d.Address() == o.Daddr &&
+				fwd == govs.FWD_FULLNAT {
+				return nil
+			}
+		}
+	}
+
+	err := govs.Check_laddrs_ctx(context.Background(), o)
+	if errors.Is(err, govs.ErrNoLaddr) {
+		return fmt.Errorf("%w, add one with -laddr first", err)
+	}
+	return err
+}
+
+// ramp_dest adds or edits the dest of o with a slow start, printing
+// every weight step
+func ramp_dest(o *govs.CmdOptions, set func(*govs.CmdOptions, *govs.Ramp_options) (*govs.Vs_dest_user_r, error)) {
+	_, err := set(o, &govs.Ramp_options{
+		Period: dest_ramp,
+		Progress: func(d *govs.Vs_dest_user_r, elapsed time.Duration) {
+			fmt.Printf("%s %s weight %d/%d\n",
+				elapsed.Truncate(time.Second), d.Address(), d.Weight, o.Weight)
+		},
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(govs.Vs_cmd_r{})
+}
+
 func edit_handle(arg interface{}) {
 	var err error
 	var reply *govs.Vs_cmd_r
@@ -281,7 +404,15 @@ func edit_handle(arg interface{}) {
 	}
 	o := &opt.Opt
 
-	if o.Daddr.Ip != 0 {
+	if !o.Daddr.Is_zero() {
+		if err := check_laddrs(o, true); err != nil {
+			fmt.Println(err)
+			return
+		}
+		if dest_ramp > 0 {
+			ramp_dest(o, govs.Set_editdest_ramp)
+			return
+		}
 		reply, err = govs.Set_editdest(o)
 	} else {
 		reply, err = govs.Set_edit(o)
@@ -305,9 +436,9 @@ func del_handle(arg interface{}) {
 	}
 	o := &opt.Opt
 
-	if o.Lip != 0 {
+	if !o.Lip.Is_zero() {
 		reply, err = govs.Set_delladdr(o)
-	} else if o.Daddr.Ip != 0 {
+	} else if !o.Daddr.Is_zero() {
 		reply, err = govs.Set_deldest(o)
 	} else {
 		reply, err = govs.Set_del(o)
@@ -0,0 +1,80 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/yubo/gotool/flags"
+	"github.com/yubo/govs"
+)
+
+var import_opt struct {
+	apply  bool
+	atomic bool
+	prune  bool
+}
+
+func init() {
+	cmd := flags.NewCommand("import", "import [-apply] keepalived file, print the config of a keepalived.conf or apply it",
+		import_handle, flag.ExitOnError)
+	cmd.BoolVar(&import_opt.apply, "apply", false, "apply the config instead of printing it, as govs apply")
+	cmd.BoolVar(&import_opt.atomic, "atomic", false, "with -apply, roll back on failure")
+	cmd.BoolVar(&import_opt.prune, "prune", false, "with -apply, delete the services which are not in the file")
+}
+
+// import_local prints the config without dpvs
+func import_local() bool {
+	return !import_opt.apply
+}
+
+func import_handle(arg interface{}) {
+	opt := arg.(*govs.CallOptions)
+	if len(opt.Args) != 2 || opt.Args[0] != "keepalived" {
+		fmt.Println("usage: import [-apply [-atomic] [-prune]] keepalived file")
+		exit(2)
+	}
+
+	cfg, unsupported, err := govs.Load_keepalived(opt.Args[1])
+	for _, s := range unsupported {
+		fmt.Fprintf(os.Stderr, "%s: %s not supported, skipped\n", opt.Args[1], s)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		exit(1)
+	}
+
+	if !import_opt.apply {
+		buf, err := cfg.Yaml()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			exit(1)
+		}
+		os.Stdout.Write(buf)
+		return
+	}
+
+	ctx := context.Background()
+	plan, err := govs.Plan_config(ctx, cfg, import_opt.prune)
+	if err != nil {
+		fmt.Println(err)
+		exit(1)
+	}
+	print_plan(plan, false)
+	if !plan.Drift() {
+		return
+	}
+	if err := govs.Apply(ctx, plan, import_opt.atomic); err != nil {
+		fmt.Println(err)
+		exit(1)
+	}
+	fmt.Printf("done, %d changes\n", len(plan.Ops))
+}
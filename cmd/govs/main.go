@@ -9,38 +9,135 @@ package main
 
 import (
 	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
+	"os"
 	"os/user"
 
 	"github.com/yubo/gotool/flags"
 	"github.com/yubo/govs"
 )
 
+var (
+	verbose bool
+
+	// commands which may run without dpvs
+	local_cmds = map[string]func() bool{
+		"sched":  func() bool { return true },
+		"import": import_local,
+	}
+)
+
 var (
 	EACCES = errors.New("Permission denied (you must be root)")
 	ECONN  = errors.New("cannot connection to dpvs server")
 )
 
+func init() {
+	flag.DurationVar(&govs.DefaultClient.Timeout, "rpc_timeout", 0,
+		"give up a dpvs call after this long, e.g. 5s (0 waits forever)")
+	flag.BoolVar(&verbose, "v", false, "log every dpvs call to stderr")
+}
+
+// exit closes the dpvs connection first, os.Exit skips the
+// deferred Vs_close of main
+func exit(code int) {
+	govs.Vs_close()
+	os.Exit(code)
+}
+
+func cmd_name() string {
+	if cmd := flags.CommandLine.Cmd; cmd != nil {
+		return cmd.Name
+	}
+	return ""
+}
+
+/*
+ * parse is flags.Parse taking only the first command name as the
+ * command: flags.Parse goes on to any later argument naming one,
+ * "govs sched list" ran list. The args up to the command go to
+ * flags, the ones after it to the flags of the command.
+ */
+func parse() {
+	args := os.Args[1:]
+	flag.CommandLine.Parse(args)
+	if flag.NArg() == 0 {
+		flags.CommandLine.Parse(args)
+		return
+	}
+
+	n := len(args) - flag.NArg()
+	flags.CommandLine.Parse(args[:n+1])
+	if cmd := flags.CommandLine.Cmd; cmd != nil {
+		parse_cmd(cmd.Flag, args[n+1:])
+	}
+}
+
+func parse_cmd(fs *flag.FlagSet, args []string) {
+	fs.Parse(args)
+	if h := fs.Lookup("h"); h != nil && h.Value.String() == "true" {
+		fs.Usage()
+		os.Exit(0)
+	}
+}
+
+// verb returns the verb of "cmd [flags] verb [flags]", the flags
+// after it are parsed into the same options as the ones before
+func verb(opt *govs.CallOptions) string {
+	if len(opt.Args) == 0 {
+		return ""
+	}
+	fs := flags.CommandLine.Cmd.Flag
+	parse_cmd(fs, opt.Args[1:])
+	opt.Args = append([]string{opt.Args[0]}, fs.Args()...)
+	opt.Opt = govs.CmdOpt
+	return opt.Args[0]
+}
+
 func main() {
 
-	flags.Parse()
+	parse()
 
-	usr, err := user.Current()
-	if err != nil {
-		fmt.Println(err.Error())
+	if verbose {
+		govs.DefaultClient.Use(govs.Log_interceptor(
+			slog.New(slog.NewTextHandler(os.Stderr, nil))))
+	}
+
+	// commands without dpvs
+	cmd := flags.CommandLine.Cmd
+	if local, ok := local_cmds[cmd_name()]; ok && local() {
+		cmd.Action(&govs.CallOptions{Opt: govs.CmdOpt,
+			Args: cmd.Flag.Args()})
 		return
 	}
 
-	if usr.Uid != "0" {
-		fmt.Println(EACCES.Error())
+	ep, config, err := endpoint()
+	if err != nil {
+		fmt.Println(err)
 		return
 	}
 
-	cmd := flags.CommandLine.Cmd
-	if cmd != nil && cmd.Action != nil {
-		err := govs.Vs_dial()
+	// only the local unix socket needs root
+	if network, _, _ := govs.Parse_endpoint(ep); network == "unix" {
+		usr, err := user.Current()
 		if err != nil {
-			fmt.Println(ECONN.Error())
+			fmt.Println(err.Error())
+			return
+		}
+
+		if usr.Uid != "0" {
+			fmt.Println(EACCES.Error())
+			return
+		}
+	}
+
+	if cmd != nil && cmd.Name == "proxy" {
+		cmd.Action(&proxy_options{upstream: ep, config: config})
+	} else if cmd != nil && cmd.Action != nil {
+		if err := govs.Vs_dial_endpoint(ep, config); err != nil {
+			fmt.Printf("%s %s: %s\n", ECONN.Error(), ep, err)
 			return
 		}
 
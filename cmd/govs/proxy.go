@@ -0,0 +1,161 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"io"
+	"log"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/yubo/gotool/flags"
+	"github.com/yubo/govs"
+)
+
+var (
+	errProxyAuth = errors.New("refusing to proxy without client authentication, " +
+		"use tls:// with -client_ca or set -insecure")
+)
+
+type proxy_options struct {
+	upstream string
+	config   *tls.Config
+}
+
+var proxy_opt struct {
+	listen    string
+	cert      string
+	key       string
+	client_ca string
+	allow     string
+	insecure  bool
+}
+
+func init() {
+	cmd := flags.NewCommand("proxy", "forward tcp/tls clients to the local dpvs",
+		proxy_handle, flag.ExitOnError)
+	cmd.StringVar(&proxy_opt.listen, "listen", "tls://:6000", "tcp://host:port or tls://host:port")
+	cmd.StringVar(&proxy_opt.cert, "cert", "", "server certificate file")
+	cmd.StringVar(&proxy_opt.key, "key", "", "server key file")
+	cmd.StringVar(&proxy_opt.client_ca, "client_ca", "", "CA file to verify client certificates")
+	cmd.StringVar(&proxy_opt.allow, "allow", "", "comma separated client certificate CNs allowed, default any")
+	cmd.BoolVar(&proxy_opt.insecure, "insecure", false, "accept clients without a verified certificate")
+}
+
+func proxy_listen() (net.Listener, error) {
+	network, addr, err := govs.Parse_endpoint(proxy_opt.listen)
+	if err != nil {
+		return nil, err
+	}
+
+	if network != "tls" {
+		if !proxy_opt.insecure {
+			return nil, errProxyAuth
+		}
+		return net.Listen(network, addr)
+	}
+
+	if proxy_opt.client_ca == "" && !proxy_opt.insecure {
+		return nil, errProxyAuth
+	}
+
+	config, err := govs.Tls_config(proxy_opt.client_ca, proxy_opt.cert, proxy_opt.key)
+	if err != nil {
+		return nil, err
+	}
+	if proxy_opt.client_ca != "" {
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return tls.Listen("tcp", addr, config)
+}
+
+// allowed checks the verified client certificate against -allow
+func allowed(c *tls.Conn) bool {
+	if proxy_opt.allow == "" {
+		return true
+	}
+
+	certs := c.ConnectionState().PeerCertificates
+	if len(certs) == 0 {
+		return false
+	}
+	for _, cn := range strings.Split(proxy_opt.allow, ",") {
+		if strings.TrimSpace(cn) == certs[0].Subject.CommonName {
+			return true
+		}
+	}
+	return false
+}
+
+func proxy_conn(c net.Conn, dial govs.Dialer) {
+	defer c.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if tc, ok := c.(*tls.Conn); ok {
+		if err := tc.HandshakeContext(ctx); err != nil {
+			log.Printf("%s: %s", c.RemoteAddr(), err)
+			return
+		}
+		if !allowed(tc) {
+			log.Printf("%s: client certificate not allowed", c.RemoteAddr())
+			return
+		}
+	}
+
+	up, err := dial(ctx)
+	if err != nil {
+		log.Printf("%s: %s", c.RemoteAddr(), err)
+		return
+	}
+	defer up.Close()
+
+	done := make(chan struct{}, 2)
+	go func() {
+		io.Copy(up, c)
+		done <- struct{}{}
+	}()
+	go func() {
+		io.Copy(c, up)
+		done <- struct{}{}
+	}()
+	<-done
+}
+
+func proxy_handle(arg interface{}) {
+	opt := arg.(*proxy_options)
+
+	dial, err := govs.Endpoint_dialer(opt.upstream, opt.config)
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	l, err := proxy_listen()
+	if err != nil {
+		log.Println(err)
+		return
+	}
+	defer l.Close()
+
+	log.Printf("proxy %s -> %s", proxy_opt.listen, opt.upstream)
+	for {
+		c, err := l.Accept()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+		go proxy_conn(c, dial)
+	}
+}
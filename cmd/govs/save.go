@@ -0,0 +1,41 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/yubo/gotool/flags"
+	"github.com/yubo/govs"
+)
+
+func init() {
+	flags.NewCommand("save", "save, dump the services, dests and laddrs as ipvsadm rules",
+		save_handle, flag.ExitOnError)
+	flags.NewCommand("restore", "restore < rules, replay ipvsadm rules from stdin",
+		restore_handle, flag.ExitOnError)
+}
+
+func save_handle(arg interface{}) {
+	if err := govs.Save(context.Background(), os.Stdout); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		exit(1)
+	}
+}
+
+func restore_handle(arg interface{}) {
+	n, err := govs.Restore(context.Background(), os.Stdin)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s, %d rules restored\n", err, n)
+		exit(1)
+	}
+	fmt.Printf("%d rules restored\n", n)
+}
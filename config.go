@@ -0,0 +1,290 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+/*
+ * Config is the declarative state of dpvs, in yaml or json
+ *
+ *   services:
+ *     - addr: 10.0.0.1:80
+ *       protocol: tcp            # default tcp
+ *       sched: wrr               # default rr
+ *       sched_opts: mh-table=65537
+ *       flags: persistent,synproxy
+ *       timeout: 300
+ *       netmask: 255.255.255.0
+ *       dests:
+ *         - addr: 192.168.1.2:8080
+ *           weight: 10
+ *           fwd: fullnat         # default fullnat
+ *           conn_flags: synproxy
+ *           u_threshold: 1000
+ *           l_threshold: 800
+ *       laddrs: [192.168.1.100, 192.168.1.101]
+ */
+type Config struct {
+	Services []Service_config `json:"services" yaml:"services"`
+}
+
+type Service_config struct {
+	Addr       Inet_addr     `json:"addr" yaml:"addr"`
+	Protocol   Protocol      `json:"protocol" yaml:"protocol"`
+	Sched      string        `json:"sched,omitempty" yaml:"sched,omitempty"`
+	Sched_opts Sched_opts    `json:"sched_opts,omitempty" yaml:"sched_opts,omitempty"`
+	Flags      SvcFlags      `json:"flags,omitempty" yaml:"flags,omitempty"`
+	Timeout    uint          `json:"timeout,omitempty" yaml:"timeout,omitempty"`
+	Netmask    Be32          `json:"netmask,omitempty" yaml:"netmask,omitempty"`
+	Dests      []Dest_config `json:"dests,omitempty" yaml:"dests,omitempty"`
+	Laddrs     []Inet_addr   `json:"laddrs,omitempty" yaml:"laddrs,flow,omitempty"`
+}
+
+type Dest_config struct {
+	Addr        Inet_addr `json:"addr" yaml:"addr"`
+	Weight      int       `json:"weight" yaml:"weight"`
+	Fwd         Fwd       `json:"fwd,omitempty" yaml:"fwd,omitempty"`
+	Conn_flags  ConnFlags `json:"conn_flags,omitempty" yaml:"conn_flags,omitempty"`
+	U_threshold uint      `json:"u_threshold,omitempty" yaml:"u_threshold,omitempty"`
+	L_threshold uint      `json:"l_threshold,omitempty" yaml:"l_threshold,omitempty"`
+}
+
+func Load_config(file string) (*Config, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := Parse_config(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", file, err)
+	}
+	return cfg, nil
+}
+
+// Parse_config reads json if data starts with '{', yaml otherwise
+func Parse_config(data []byte) (*Config, error) {
+	var tree interface{}
+
+	is_json := false
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '{' {
+		is_json = true
+		d := json.NewDecoder(bytes.NewReader(data))
+		d.UseNumber()
+		if err := d.Decode(&tree); err != nil {
+			return nil, err
+		}
+	} else {
+		var err error
+		if tree, err = parse_yaml(data); err != nil {
+			return nil, err
+		}
+	}
+
+	/* a service without protocol is tcp, the zero Protocol is any */
+	if m, ok := tree.(map[string]interface{}); ok {
+		if svcs, ok := m["services"].([]interface{}); ok {
+			for _, svc := range svcs {
+				if svc, ok := svc.(map[string]interface{}); ok {
+					if _, ok := svc["protocol"]; !ok {
+						svc["protocol"] = "tcp"
+					}
+					if !is_json {
+						yaml_addrs(svc)
+					}
+				}
+			}
+		}
+	}
+
+	buf, err := json.Marshal(tree)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{}
+	d := json.NewDecoder(bytes.NewReader(buf))
+	d.DisallowUnknownFields()
+	if err := d.Decode(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, cfg.Check()
+}
+
+// Yaml renders cfg in the yaml Load_config reads
+func (cfg *Config) Yaml() ([]byte, error) {
+	return marshal_yaml(cfg)
+}
+
+// Check validates cfg without asking dpvs
+func (cfg *Config) Check() error {
+	svcs := make(map[svc_key]bool)
+
+	for i := range cfg.Services {
+		s := &cfg.Services[i]
+		where := fmt.Sprintf("services[%d] %s", i, s.key())
+
+		if s.Addr.Is_zero() {
+			return fmt.Errorf("services[%d]: no addr", i)
+		}
+		if _, ok := protocol_names[uint8(s.Protocol)]; !ok {
+			return fmt.Errorf("%s: %w", where, errProtocol)
+		}
+		if svcs[s.key()] {
+			return fmt.Errorf("%s: duplicate service", where)
+		}
+		svcs[s.key()] = true
+
+		o := s.options()
+		if err := check_sched(&o); err != nil {
+			return fmt.Errorf("%s: %w", where, err)
+		}
+
+		dests := make(map[Inet_addr]bool)
+		for j := range s.Dests {
+			d := &s.Dests[j]
+			if d.Addr.Is_zero() {
+				return fmt.Errorf("%s dests[%d]: no addr", where, j)
+			}
+			if d.Weight < 0 {
+				return fmt.Errorf("%s dest %s: negative weight", where, d.Addr)
+			}
+			if d.U_threshold != 0 && d.L_threshold > d.U_threshold {
+				return fmt.Errorf("%s dest %s: l_threshold above u_threshold", where, d.Addr)
+			}
+			if dests[d.Addr] {
+				return fmt.Errorf("%s dest %s: duplicate dest", where, d.Addr)
+			}
+			dests[d.Addr] = true
+		}
+
+		laddrs := make(map[Inet_addr]bool)
+		for _, l := range s.Laddrs {
+			if l.Is_zero() || l.Port != 0 {
+				return fmt.Errorf("%s laddr %s: expect an address without port", where, l)
+			}
+			if laddrs[l] {
+				return fmt.Errorf("%s laddr %s: duplicate laddr", where, l.Ip_string())
+			}
+			laddrs[l] = true
+		}
+	}
+	return nil
+}
+
+// svc_key identifies a service, Addr.Af is never 0
+type svc_key struct {
+	protocol Protocol
+	addr     Inet_addr
+}
+
+func (k svc_key) String() string {
+	return fmt.Sprintf("%s %s", k.protocol, k.addr)
+}
+
+func (s *Service_config) key() svc_key {
+	return svc_key{s.Protocol, inet_addr(s.Addr.Af, s.Addr.Ip, s.Addr.Ip6, s.Addr.Port)}
+}
+
+func (s *Service_config) options() CmdOptions {
+	sched := s.Sched
+	if sched == "" {
+		sched = "rr"
+	}
+	return CmdOptions{
+		Addr:       s.Addr,
+		Protocol:   s.Protocol,
+		Sched_name: sched,
+		Sched_opts: s.Sched_opts,
+		Flags:      s.Flags,
+		Timeout:    s.Timeout,
+		Netmask:    s.Netmask,
+	}
+}
+
+func (d *Dest_config) options(svc *CmdOptions) CmdOptions {
+	o := *svc
+	o.Daddr = d.Addr
+	o.Weight = d.Weight
+	o.Fwd = d.Fwd
+	o.Conn_flags = d.Conn_flags
+	o.U_threshold = d.U_threshold
+	o.L_threshold = d.L_threshold
+	/* a dest of the config without fwd is FULLNAT, on edits too */
+	if fwd, ok := Conn_fwd(dest_conn_flags(&o)); ok {
+		o.Fwd = fwd
+	}
+	return o
+}
+
+// Get_config reads the services, dests and local addresses of dpvs
+// into a Config
+func (c *Client) Get_config(ctx context.Context) (*Config, error) {
+	svcs, err := c.Get_services_ctx(ctx, &CmdOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &Config{Services: []Service_config{}}
+	for i := range svcs.Services {
+		svc := &svcs.Services[i]
+		s := Service_config{
+			Addr:     svc.Address(),
+			Protocol: Protocol(svc.Protocol),
+			Sched:    svc.Sched_name,
+			Flags:    SvcFlags(svc.Flags & VS_SVC_F_MASK),
+			Timeout:  uint(svc.Timeout),
+			Netmask:  svc.Netmask,
+		}
+		if svc.Sched_flags != 0 || svc.Sched_table != 0 {
+			s.Sched_opts = Sched_opts{Sched: svc.Sched_name,
+				Flags: uint(svc.Sched_flags), Table: svc.Sched_table}
+		}
+
+		o := s.options()
+		dests, err := c.Get_dests_ctx(ctx, &o)
+		if err != nil {
+			return nil, err
+		}
+		for j := range dests.Dests {
+			d := &dests.Dests[j]
+			dc := Dest_config{
+				Addr:        d.Address(),
+				Weight:      d.Weight,
+				Conn_flags:  ConnFlags(d.Conn_flags & conn_flags_mask() &^ VS_CONN_F_FWD_MASK),
+				U_threshold: uint(d.U_threshold),
+				L_threshold: uint(d.L_threshold),
+			}
+			if fwd, ok := Conn_fwd(d.Conn_flags); ok {
+				dc.Fwd = fwd
+			} else {
+				dc.Conn_flags |= ConnFlags(d.Conn_flags & VS_CONN_F_FWD_MASK)
+			}
+			s.Dests = append(s.Dests, dc)
+		}
+
+		laddrs, err := c.Get_laddrs_ctx(ctx, &o)
+		if err != nil {
+			return nil, err
+		}
+		for j := range laddrs.Laddrs {
+			s.Laddrs = append(s.Laddrs, laddrs.Laddrs[j].Address())
+		}
+		cfg.Services = append(cfg.Services, s)
+	}
+	return cfg, nil
+}
+
+func Get_config(ctx context.Context) (*Config, error) {
+	return DefaultClient.Get_config(ctx)
+}
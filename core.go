@@ -8,11 +8,10 @@
 package govs
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"net"
-	"net/rpc"
-	"net/rpc/jsonrpc"
 	"strconv"
 	"strings"
 )
@@ -55,7 +54,6 @@ const (
 )
 
 var (
-	client *rpc.Client
 	CmdOpt CmdOptions
 )
 
@@ -69,13 +67,17 @@ type CmdOptions struct {
 	Typ string
 	Id  int
 	/* service */
-	Addr       Addr4
+	Addr       Inet_addr
 	Nic        uint
 	Protocol   Protocol
 	TCP        string
 	UDP        string
+	SCTP       string
+	ICMP       string
+	ANY        string
 	Sched_name string
-	Flags      uint
+	Sched_opts Sched_opts
+	Flags      SvcFlags
 	Number     int
 	Timeout    uint
 	Timeout_s  string
@@ -84,8 +86,9 @@ type CmdOptions struct {
 	/* dest */
 	D           bool
 	Dnic        uint
-	Daddr       Addr4
-	Conn_flags  uint
+	Daddr       Inet_addr
+	Conn_flags  ConnFlags
+	Fwd         Fwd
 	Weight      int
 	U_threshold uint
 	L_threshold uint
@@ -93,12 +96,17 @@ type CmdOptions struct {
 	/* local addr */
 	L    bool
 	Lnic uint
-	Lip  Be32
+	Lip  Inet_addr
 
 	/* timeout */
 	Tcp_timeout     int
 	Tcp_fin_timeout int
 	Udp_timeout     int
+
+	/* sync daemon */
+	Sync_state Sync_state
+	Mcast_ifn  string
+	Syncid     int
 }
 
 type Be32 uint32
@@ -107,39 +115,20 @@ func (p *Be32) Set(value string) error {
 	if value == "" {
 		return nil
 	}
-	if ip := net.ParseIP(value).To4(); ip != nil {
-		*p = Htonl(ipToU32(ip))
-	}
-	return nil
+	return p.UnmarshalText([]byte(value))
 }
 
 func (p Be32) String() string {
 	return be32_to_addr(p)
 }
 
-func (p *Be32) UnmarshalJSON(data []byte) error {
-	var i int32
-	if err := json.Unmarshal(data, &i); err != nil {
-		return err
-	}
-	*p = Be32(uint32(i))
-	return nil
-}
-
 type Be16 uint16
 
 func (p *Be16) Set(value string) error {
 	if value == "" {
 		return nil
 	}
-
-	port, err := strconv.Atoi(value)
-	if err != nil {
-		return err
-	}
-
-	*p = Htons(uint16(port))
-	return nil
+	return p.UnmarshalText([]byte(value))
 }
 
 func (p Be16) String() string {
@@ -181,6 +170,124 @@ func (p *Addr4) String() string {
 	return fmt.Sprintf("%s:%d", be32_to_addr(p.Ip), Ntohs(p.Port))
 }
 
+const (
+	AF_INET  = 2
+	AF_INET6 = 10
+)
+
+// In6_addr is an ipv6 address in network order
+type In6_addr [16]byte
+
+func (p In6_addr) String() string {
+	return net.IP(p[:]).String()
+}
+
+func (p In6_addr) Is_zero() bool {
+	return p == In6_addr{}
+}
+
+// Inet_addr is an ipv4 or ipv6 address with an optional port,
+// Ip is used for AF_INET and Ip6 for AF_INET6.
+type Inet_addr struct {
+	Af   uint16
+	Ip   Be32
+	Ip6  In6_addr
+	Port Be16
+}
+
+// inet_addr builds an Inet_addr from a reply, dpvs without ipv6
+// support does not send Af
+func inet_addr(af uint16, ip Be32, ip6 In6_addr, port Be16) Inet_addr {
+	if af == 0 {
+		af = AF_INET
+	}
+	return Inet_addr{Af: af, Ip: ip, Ip6: ip6, Port: port}
+}
+
+/*
+ * 192.168.0.1, 192.168.0.1:80,
+ * 2001:db8::1, [2001:db8::1], [2001:db8::1]:443
+ */
+func (p *Inet_addr) Set(value string) error {
+	*p = Inet_addr{}
+	if value == "" {
+		return nil
+	}
+
+	host, port := value, ""
+	if strings.HasPrefix(value, "[") {
+		i := strings.Index(value, "]")
+		if i < 0 {
+			return errInetAddr
+		}
+		host, port = value[1:i], value[i+1:]
+		if port != "" {
+			if port[0] != ':' {
+				return errInetAddr
+			}
+			port = port[1:]
+		}
+	} else if strings.Count(value, ":") == 1 {
+		i := strings.Index(value, ":")
+		host, port = value[:i], value[i+1:]
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return errInetAddr
+	}
+	if ip4 := ip.To4(); ip4 != nil && !strings.Contains(host, ":") {
+		p.Af = AF_INET
+		p.Ip = Htonl(ipToU32(ip4))
+	} else {
+		p.Af = AF_INET6
+		copy(p.Ip6[:], ip.To16())
+	}
+
+	if port != "" {
+		n, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			return errInetAddr
+		}
+		p.Port = Htons(uint16(n))
+	}
+	return nil
+}
+
+// af is the address family to send, AF_INET for the zero address
+func (p *Inet_addr) af() uint16 {
+	if p.Af == 0 {
+		return AF_INET
+	}
+	return p.Af
+}
+
+func (p Inet_addr) Is_zero() bool {
+	return p.Ip == 0 && p.Ip6.Is_zero()
+}
+
+func (p Inet_addr) IP() net.IP {
+	if p.Af == AF_INET6 {
+		return net.IP(p.Ip6[:])
+	}
+	return net.ParseIP(be32_to_addr(p.Ip))
+}
+
+// Ip_string returns the address without the port
+func (p Inet_addr) Ip_string() string {
+	if p.Af == AF_INET6 {
+		return p.Ip6.String()
+	}
+	return be32_to_addr(p.Ip)
+}
+
+func (p Inet_addr) String() string {
+	if p.Af == AF_INET6 {
+		return fmt.Sprintf("[%s]:%d", p.Ip6, Ntohs(p.Port))
+	}
+	return fmt.Sprintf("%s:%d", be32_to_addr(p.Ip), Ntohs(p.Port))
+}
+
 type Vs_timeout_q struct {
 	Cmd             int
 	Tcp_timeout     int
@@ -218,7 +325,7 @@ func (r Vs_timeout_r) String() string {
 		return fmt.Sprintf("tcp:%d tcp_fin:%d udp:%d",
 			r.Tcp_timeout, r.Tcp_fin_timeout, r.Udp_timeout)
 	} else {
-		return fmt.Sprintf("%s:%s", Ecode(r.Code), r.Msg)
+		return errstr(r.Code, r.Msg)
 	}
 }
 
@@ -232,6 +339,8 @@ const (
 	__VS_STATS_MAX
 )
 
+var stats_names = []string{"io", "worker", "estats worker", "dev", "ctl", "mem"}
+
 const (
 	VS_CMD_UNSPEC       = iota
 	VS_CMD_NEW_SERVICE  /* add service */
@@ -259,6 +368,39 @@ const (
 	__VS_CMD_MAX
 )
 
+var cmd_names = []string{
+	"unspec",
+	"new service",
+	"set service",
+	"del service",
+	"get service",
+	"get services",
+	"new dest",
+	"set dest",
+	"del dest",
+	"get dest",
+	"new daemon",
+	"del daemon",
+	"get daemon",
+	"set config",
+	"get config",
+	"set info",
+	"get info",
+	"zero",
+	"flush",
+	"new laddr",
+	"del laddr",
+	"get laddr",
+	"get stats",
+}
+
+func Cmd_name(cmd int) string {
+	if cmd < 0 || cmd >= len(cmd_names) {
+		return fmt.Sprintf("cmd %d", cmd)
+	}
+	return cmd_names[cmd]
+}
+
 const (
 	IPPROTO_IP      = 0   /* Dummy protocol for TCP		*/
 	IPPROTO_ICMP    = 1   /* Internet Control Message Protocol	*/
@@ -275,6 +417,7 @@ const (
 	IPPROTO_GRE     = 47  /* Cisco GRE tunnels (rfc 1701,1702)	*/
 	IPPROTO_ESP     = 50  /* Encapsulation Security Payload protocol */
 	IPPROTO_AH      = 51  /* Authentication Header protocol       */
+	IPPROTO_ICMPV6  = 58  /* ICMPv6					*/
 	IPPROTO_BEETPH  = 94  /* IP option pseudo header for BEET */
 	IPPROTO_PIM     = 103 /* Protocol Independent Multicast	*/
 	IPPROTO_COMP    = 108 /* Compression Header protocol */
@@ -283,21 +426,34 @@ const (
 	IPPROTO_RAW     = 255 /* Raw IP packets			*/
 )
 
+var (
+	protocol_names = map[uint8]string{
+		IPPROTO_IP:      "any",
+		IPPROTO_ICMP:    "icmp",
+		IPPROTO_TCP:     "tcp",
+		IPPROTO_UDP:     "udp",
+		IPPROTO_ICMPV6:  "icmpv6",
+		IPPROTO_SCTP:    "sctp",
+		IPPROTO_UDPLITE: "udplite",
+	}
+)
+
 type Protocol uint8
 
+// Set accepts the name of a protocol in protocol_names
 func (p *Protocol) Set(value string) error {
-	if value == "tcp" {
-		*p = IPPROTO_TCP
-	} else if value == "udp" {
-		*p = IPPROTO_UDP
-	} else {
-		return errProtocol
+	value = strings.ToLower(value)
+	for proto, name := range protocol_names {
+		if name == value {
+			*p = Protocol(proto)
+			return nil
+		}
 	}
-	return nil
+	return errProtocol
 }
 
-func (p *Protocol) String() string {
-	return get_protocol_name(uint8(*p))
+func (p Protocol) String() string {
+	return get_protocol_name(uint8(p))
 }
 
 type Vs_timeout_user struct {
@@ -319,7 +475,7 @@ func (r Vs_cmd_r) String() string {
 	if r.Code == 0 {
 		return fmt.Sprintf("done")
 	} else {
-		return fmt.Sprintf("%s:%s", Ecode(r.Code), r.Msg)
+		return errstr(r.Code, r.Msg)
 	}
 }
 
@@ -332,56 +488,103 @@ type Vs_version_r struct {
 
 func (r Vs_version_r) String() string {
 	if r.Code != 0 {
-		return fmt.Sprintf("%s:%s", Ecode(r.Code), r.Msg)
+		return errstr(r.Code, r.Msg)
 	}
 
-	return fmt.Sprintf("version\t\t%d.%d.%d\n"+
+	return fmt.Sprintf("version\t\t%s\n"+
 		"conn table size\t%d",
-		(r.Version>>16)&0xff,
-		(r.Version>>8)&0xff,
-		(r.Version)&0xff,
-		r.Size)
+		version_string(r.Version), r.Size)
 }
-func Vs_dial() error {
-	conn, err := net.Dial("unix", URL)
-	if err != nil {
+
+func version_string(v int) string {
+	return fmt.Sprintf("%d.%d.%d", (v>>16)&0xff, (v>>8)&0xff, v&0xff)
+}
+
+// Check_protocol checks p against what the connected dpvs balances.
+// dpvs has no call to list its protocols, so the client learns them
+// from Set_add: a protocol dpvs refused on this connection is refused
+// here without a call, tcp and udp are always accepted.
+func (c *Client) Check_protocol(ctx context.Context, p Protocol) error {
+	if _, ok := protocol_names[uint8(p)]; !ok {
+		return errProtocol
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.refused[uint8(p)]
+}
+
+func Check_protocol(ctx context.Context, p Protocol) error {
+	return DefaultClient.Check_protocol(ctx, p)
+}
+
+// refuse_protocol records that dpvs refused p with err, which is
+// returned with the dpvs version
+func (c *Client) refuse_protocol(ctx context.Context, p Protocol, err error) error {
+	if !errors.Is(err, ErrProtoNotSupported) || p == IPPROTO_TCP || p == IPPROTO_UDP {
 		return err
 	}
-	client = jsonrpc.NewClient(conn)
-	return nil
+	if v, verr := c.Get_version_ctx(ctx); verr == nil {
+		err = fmt.Errorf("dpvs %s does not balance %s: %w",
+			version_string(v.Version), p, err)
+	}
+	c.mu.Lock()
+	if c.refused == nil {
+		c.refused = make(map[uint8]error)
+	}
+	c.refused[uint8(p)] = err
+	c.mu.Unlock()
+	return err
+}
+
+func Vs_dial() error {
+	return DefaultClient.Dial()
 }
 
 func Vs_close() {
-	if client != nil {
-		client.Close()
-	}
+	DefaultClient.Close()
 }
 
-func Get_version() (*Vs_version_r, error) {
+func (c *Client) Get_version() (*Vs_version_r, error) {
+	return c.Get_version_ctx(context.Background())
+}
+
+func (c *Client) Get_version_ctx(ctx context.Context) (*Vs_version_r, error) {
 	var reply Vs_version_r
 	args := Vs_cmd_q{VS_CMD_GET_INFO}
 
-	err := client.Call("api", args, &reply)
+	err := c.call(ctx, "api", args, &reply)
 	return &reply, err
 }
 
-func Get_timeout(o *CmdOptions) (*Vs_timeout_r, error) {
+func (c *Client) Get_timeout(o *CmdOptions) (*Vs_timeout_r, error) {
+	return c.Get_timeout_ctx(context.Background(), o)
+}
+
+func (c *Client) Get_timeout_ctx(ctx context.Context, o *CmdOptions) (*Vs_timeout_r, error) {
 	args := Vs_timeout_q{Cmd: VS_CMD_GET_CONFIG}
 	reply := &Vs_timeout_r{}
 
-	err := client.Call("api", args, reply)
+	err := c.call(ctx, "api", args, reply)
 	return reply, err
 }
 
-func Set_flush(o *CmdOptions) (*Vs_cmd_r, error) {
+func (c *Client) Set_flush(o *CmdOptions) (*Vs_cmd_r, error) {
+	return c.Set_flush_ctx(context.Background(), o)
+}
+
+func (c *Client) Set_flush_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
 	var reply Vs_cmd_r
 	args := Vs_cmd_q{VS_CMD_FLUSH}
 
-	err := client.Call("api", args, &reply)
+	err := c.call(ctx, "api", args, &reply)
 	return &reply, err
 }
 
-func Set_timeout(o *CmdOptions) (*Vs_cmd_r, error) {
+func (c *Client) Set_timeout(o *CmdOptions) (*Vs_cmd_r, error) {
+	return c.Set_timeout_ctx(context.Background(), o)
+}
+
+func (c *Client) Set_timeout_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
 	var reply Vs_cmd_r
 	args := Vs_timeout_q{Cmd: VS_CMD_SET_CONFIG}
 
@@ -389,21 +592,61 @@ func Set_timeout(o *CmdOptions) (*Vs_cmd_r, error) {
 		return nil, err
 	}
 
-	err := client.Call("api", args, &reply)
+	err := c.call(ctx, "api", args, &reply)
 	return &reply, err
 }
 
-func Set_zero(o *CmdOptions) (*Vs_cmd_r, error) {
+func (c *Client) Set_zero(o *CmdOptions) (*Vs_cmd_r, error) {
+	return c.Set_zero_ctx(context.Background(), o)
+}
+
+func (c *Client) Set_zero_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
 	var reply Vs_cmd_r
 	args := Vs_service_q{
-		Cmd: VS_CMD_ZERO,
-		Service: Vs_service_user{
-			Addr:     o.Addr.Ip,
-			Port:     o.Addr.Port,
-			Protocol: uint8(o.Protocol),
-		},
+		Cmd:     VS_CMD_ZERO,
+		Service: service_key(o),
 	}
 
-	err := client.Call("api", args, &reply)
+	err := c.call(ctx, "api", args, &reply)
 	return &reply, err
 }
+
+func Get_version() (*Vs_version_r, error) {
+	return DefaultClient.Get_version()
+}
+
+func Get_version_ctx(ctx context.Context) (*Vs_version_r, error) {
+	return DefaultClient.Get_version_ctx(ctx)
+}
+
+func Get_timeout(o *CmdOptions) (*Vs_timeout_r, error) {
+	return DefaultClient.Get_timeout(o)
+}
+
+func Get_timeout_ctx(ctx context.Context, o *CmdOptions) (*Vs_timeout_r, error) {
+	return DefaultClient.Get_timeout_ctx(ctx, o)
+}
+
+func Set_flush(o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_flush(o)
+}
+
+func Set_flush_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_flush_ctx(ctx, o)
+}
+
+func Set_timeout(o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_timeout(o)
+}
+
+func Set_timeout_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_timeout_ctx(ctx, o)
+}
+
+func Set_zero(o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_zero(o)
+}
+
+func Set_zero_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_zero_ctx(ctx, o)
+}
@@ -8,13 +8,17 @@
 package govs
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 )
 
 type Vs_dest_user struct {
 	Nic         uint8
+	Af          uint16
 	Addr        Be32
+	Addr6       In6_addr
 	Port        Be16
 	Conn_flags  uint
 	Weight      int
@@ -22,8 +26,24 @@ type Vs_dest_user struct {
 	L_threshold uint32
 }
 
+// MarshalJSON leaves Af and Addr6 out of an ipv4 dest, the wire
+// format of dpvs without ipv6 support
+func (u Vs_dest_user) MarshalJSON() ([]byte, error) {
+	type user Vs_dest_user
+	if u.Af == AF_INET6 {
+		return json.Marshal(user(u))
+	}
+	return json.Marshal(struct {
+		user
+		Af    *uint16   `json:",omitempty"`
+		Addr6 *In6_addr `json:",omitempty"`
+	}{user: user(u)})
+}
+
 type Vs_dest_user_r struct {
+	Af          uint16
 	Addr        Be32
+	Addr6       In6_addr
 	Port        Be16
 	Conn_flags  uint
 	Weight      int
@@ -40,25 +60,39 @@ type Vs_dest_user_r struct {
 }
 
 const (
-	fmt_dest_t = "%5s %21s %8s %8s %15s %12s %12s %12s %7s %10s %10s %10s %10s"
-	fmt_dest   = "%5s %21s %08x %8d %15s %12d %12d %12d %7d %10d %10d %10d %10d"
+	fmt_dest_t = "%7s %47s %7s %20s %8s %15s %12s %12s %12s %7s %10s %10s %10s %10s"
+	fmt_dest   = "%7s %47s %7s %20s %8d %15s %12d %12d %12d %7d %10d %10d %10d %10d"
 )
 
 func Dest_title() string {
 	return fmt.Sprintf(fmt_dest_t,
-		"->", "Addr:Port", "Flags", "Weight", "threshold",
+		"->", "Addr:Port", "Fwd", "Flags", "Weight", "threshold",
 		"Activeconns", "Inactconns", "Persistent",
 		"Conns", "Inpkts", "Outpkts", "Inbytes", "Outbytes")
 }
 
 func (d Vs_dest_user_r) String() string {
 	return fmt.Sprintf(fmt_dest,
-		"->", fmt.Sprintf("%s:%s", d.Addr.String(), d.Port.String()), d.Conn_flags,
+		"->", d.Address().String(), d.Fwd(),
+		join_flags(d.Conn_flags&^VS_CONN_F_FWD_MASK, conn_flag_names, nil),
 		d.Weight, fmt.Sprintf("%d-%d", d.L_threshold, d.U_threshold),
 		d.Activeconns, d.Inactconns, d.Persistent,
 		d.Conns, d.Inpkts, d.Outpkts, d.Inbytes, d.Outbytes)
 }
 
+// Fwd names the forwarding method of the dest
+func (d *Vs_dest_user_r) Fwd() string {
+	if fwd, ok := Conn_fwd(d.Conn_flags); ok {
+		return fwd.String()
+	}
+	return strings.ToLower(ConnFlags(d.Conn_flags & VS_CONN_F_FWD_MASK).String())
+}
+
+// Address returns the address and port of the dest
+func (d *Vs_dest_user_r) Address() Inet_addr {
+	return inet_addr(d.Af, d.Addr, d.Addr6, d.Port)
+}
+
 type Vs_list_dests_r struct {
 	Code  int
 	Msg   string
@@ -68,7 +102,7 @@ type Vs_list_dests_r struct {
 func (r Vs_list_dests_r) String() string {
 	var s string
 	if r.Code != 0 {
-		return fmt.Sprintf("%s:%s", Ecode(r.Code), r.Msg)
+		return errstr(r.Code, r.Msg)
 	}
 	for _, dest := range r.Dests {
 		s += fmt.Sprintf("%s\n", dest)
@@ -77,19 +111,19 @@ func (r Vs_list_dests_r) String() string {
 	return strings.TrimRight(s, "\n")
 }
 
-func Get_dests(o *CmdOptions) (*Vs_list_dests_r, error) {
+func (c *Client) Get_dests(o *CmdOptions) (*Vs_list_dests_r, error) {
+	return c.Get_dests_ctx(context.Background(), o)
+}
+
+func (c *Client) Get_dests_ctx(ctx context.Context, o *CmdOptions) (*Vs_list_dests_r, error) {
 	var reply Vs_list_dests_r
 	args := Vs_list_q{
-		Cmd: VS_CMD_GET_DEST,
-		Service: Vs_service_user{
-			Addr:     o.Addr.Ip,
-			Port:     o.Addr.Port,
-			Protocol: uint8(o.Protocol),
-			Number:   o.Number,
-		},
+		Cmd:     VS_CMD_GET_DEST,
+		Service: service_key(o),
 	}
+	args.Service.Number = o.Number
 
-	err := client.Call("api", args, &reply)
+	err := c.call(ctx, "api", args, &reply)
 	return &reply, err
 }
 
@@ -99,69 +133,187 @@ type Vs_dest_q struct {
 	Dest    Vs_dest_user
 }
 
-func Set_adddest(o *CmdOptions) (*Vs_cmd_r, error) {
-	var reply Vs_cmd_r
+// fwd_unset tells if o sets no forwarding method, neither with Fwd
+// nor in Conn_flags
+func fwd_unset(o *CmdOptions) bool {
+	return o.Fwd == FWD_UNSET && uint(o.Conn_flags)&VS_CONN_F_FWD_MASK == 0
+}
+
+// dest_conn_flags sets the forwarding method of o.Fwd, without one
+// the method in o.Conn_flags is kept and FULLNAT is the default
+func dest_conn_flags(o *CmdOptions) uint {
+	flags := uint(o.Conn_flags)
+	if o.Fwd != FWD_UNSET {
+		return flags&^VS_CONN_F_FWD_MASK | o.Fwd.Conn_flags()
+	}
+	if flags&VS_CONN_F_FWD_MASK != 0 {
+		return flags
+	}
+	return flags | VS_CONN_F_FULLNAT
+}
+
+// keep_fwd gives the edit args the forwarding method of the live dest
+// d when o sets none
+func keep_fwd(args *Vs_dest_q, o *CmdOptions, d *Vs_dest_user_r) {
+	if fwd_unset(o) {
+		args.Dest.Conn_flags = args.Dest.Conn_flags&^VS_CONN_F_FWD_MASK |
+			d.Conn_flags&VS_CONN_F_FWD_MASK
+	}
+}
+
+func dest_q(cmd int, o *CmdOptions) Vs_dest_q {
 	args := Vs_dest_q{
-		Cmd: VS_CMD_NEW_DEST,
-		Service: Vs_service_user{
-			Protocol: uint8(o.Protocol),
-			Addr:     o.Addr.Ip,
-			Port:     o.Addr.Port,
-		},
+		Cmd:     cmd,
+		Service: service_key(o),
 		Dest: Vs_dest_user{
-			Nic:         uint8(o.Dnic),
-			Addr:        o.Daddr.Ip,
-			Port:        o.Daddr.Port,
-			Conn_flags:  o.Conn_flags | VS_CONN_F_FULLNAT,
-			Weight:      o.Weight,
-			U_threshold: uint32(o.U_threshold),
-			L_threshold: uint32(o.L_threshold),
+			Af:    o.Daddr.af(),
+			Addr:  o.Daddr.Ip,
+			Addr6: o.Daddr.Ip6,
+			Port:  o.Daddr.Port,
 		},
 	}
+	if cmd == VS_CMD_DEL_DEST {
+		return args
+	}
+
+	args.Dest.Nic = uint8(o.Dnic)
+	args.Dest.Conn_flags = dest_conn_flags(o)
+	args.Dest.Weight = o.Weight
+	args.Dest.U_threshold = uint32(o.U_threshold)
+	args.Dest.L_threshold = uint32(o.L_threshold)
+	return args
+}
+
+// find_dest reads the dest o.Daddr of the service of o
+func (c *Client) find_dest(ctx context.Context, o *CmdOptions) (*Vs_dest_user_r, error) {
+	dests, err := c.Get_dests_ctx(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+	for i := range dests.Dests {
+		d := &dests.Dests[i]
+		if d.Addr == o.Daddr.Ip && d.Addr6 == o.Daddr.Ip6 &&
+			d.Port == o.Daddr.Port {
+			return d, nil
+		}
+	}
+	return nil, &Error{Method: "api", Cmd: VS_CMD_GET_DEST,
+		Code: -ENOENT, Msg: "dest not exist"}
+}
+
+// Check_laddrs_ctx returns ErrNoLaddr for a FULLNAT dest of a service
+// without local addresses, the other forwarding methods need none.
+func (c *Client) Check_laddrs_ctx(ctx context.Context, o *CmdOptions) error {
+	if fwd, _ := Conn_fwd(dest_conn_flags(o)); fwd != FWD_FULLNAT {
+		return nil
+	}
+
+	laddrs, err := c.Get_laddrs_ctx(ctx, o)
+	if err != nil {
+		return err
+	}
+	if len(laddrs.Laddrs) == 0 {
+		return ErrNoLaddr
+	}
+	return nil
+}
 
-	err := client.Call("api", args, &reply)
+// check_dest_laddrs runs Check_laddrs_ctx for a dest command which
+// makes the dest fullnat: an add, or an edit setting the forwarding
+// method of a dest which is not fullnat yet
+func (c *Client) check_dest_laddrs(ctx context.Context, cmd int, o *CmdOptions) error {
+	if cmd == VS_CMD_SET_DEST {
+		if fwd_unset(o) {
+			return nil
+		}
+		d, err := c.find_dest(ctx, o)
+		if err != nil {
+			return err
+		}
+		if fwd, _ := Conn_fwd(d.Conn_flags); fwd == FWD_FULLNAT {
+			return nil
+		}
+	}
+	return c.Check_laddrs_ctx(ctx, o)
+}
+
+func (c *Client) Set_adddest(o *CmdOptions) (*Vs_cmd_r, error) {
+	return c.Set_adddest_ctx(context.Background(), o)
+}
+
+func (c *Client) Set_adddest_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
+	var reply Vs_cmd_r
+	args := dest_q(VS_CMD_NEW_DEST, o)
+
+	err := c.call(ctx, "api", args, &reply)
 	return &reply, err
 }
 
-func Set_editdest(o *CmdOptions) (*Vs_cmd_r, error) {
+func (c *Client) Set_editdest(o *CmdOptions) (*Vs_cmd_r, error) {
+	return c.Set_editdest_ctx(context.Background(), o)
+}
+
+// Set_editdest_ctx keeps the forwarding method of the dest if o sets
+// none, dpvs replaces the conn flags as a whole
+func (c *Client) Set_editdest_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
 	var reply Vs_cmd_r
-	args := Vs_dest_q{
-		Cmd: VS_CMD_SET_DEST,
-		Service: Vs_service_user{
-			Protocol: uint8(o.Protocol),
-			Addr:     o.Addr.Ip,
-			Port:     o.Addr.Port,
-		},
-		Dest: Vs_dest_user{
-			Nic:         uint8(o.Dnic),
-			Addr:        o.Daddr.Ip,
-			Port:        o.Daddr.Port,
-			Conn_flags:  o.Conn_flags | VS_CONN_F_FULLNAT,
-			Weight:      o.Weight,
-			U_threshold: uint32(o.U_threshold),
-			L_threshold: uint32(o.L_threshold),
-		},
+	args := dest_q(VS_CMD_SET_DEST, o)
+	if fwd_unset(o) {
+		d, err := c.find_dest(ctx, o)
+		if err != nil {
+			return &reply, err
+		}
+		keep_fwd(&args, o, d)
 	}
 
-	err := client.Call("api", args, &reply)
+	err := c.call(ctx, "api", args, &reply)
 	return &reply, err
 }
 
-func Set_deldest(o *CmdOptions) (*Vs_cmd_r, error) {
+func (c *Client) Set_deldest(o *CmdOptions) (*Vs_cmd_r, error) {
+	return c.Set_deldest_ctx(context.Background(), o)
+}
+
+func (c *Client) Set_deldest_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
 	var reply Vs_cmd_r
-	args := Vs_dest_q{
-		Cmd: VS_CMD_DEL_DEST,
-		Service: Vs_service_user{
-			Protocol: uint8(o.Protocol),
-			Addr:     o.Addr.Ip,
-			Port:     o.Addr.Port,
-		},
-		Dest: Vs_dest_user{
-			Addr: o.Daddr.Ip,
-			Port: o.Daddr.Port,
-		},
-	}
+	args := dest_q(VS_CMD_DEL_DEST, o)
 
-	err := client.Call("api", args, &reply)
+	err := c.call(ctx, "api", args, &reply)
 	return &reply, err
 }
+
+func Get_dests(o *CmdOptions) (*Vs_list_dests_r, error) {
+	return DefaultClient.Get_dests(o)
+}
+
+func Get_dests_ctx(ctx context.Context, o *CmdOptions) (*Vs_list_dests_r, error) {
+	return DefaultClient.Get_dests_ctx(ctx, o)
+}
+
+func Check_laddrs_ctx(ctx context.Context, o *CmdOptions) error {
+	return DefaultClient.Check_laddrs_ctx(ctx, o)
+}
+
+func Set_adddest(o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_adddest(o)
+}
+
+func Set_adddest_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_adddest_ctx(ctx, o)
+}
+
+func Set_editdest(o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_editdest(o)
+}
+
+func Set_editdest_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_editdest_ctx(ctx, o)
+}
+
+func Set_deldest(o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_deldest(o)
+}
+
+func Set_deldest_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_deldest_ctx(ctx, o)
+}
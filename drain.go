@@ -0,0 +1,115 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	DRAIN_INTERVAL = time.Second /* default time between two polls of a drain */
+)
+
+type Drain_options struct {
+	Timeout    time.Duration /* give up after this long, 0 waits for ctx */
+	Interval   time.Duration /* between two Get_dests, DRAIN_INTERVAL if 0 */
+	Inactive   bool          /* wait for Inactconns too */
+	Persistent bool          /* wait for the persistence templates too */
+	Delete     bool          /* delete the dest once drained */
+
+	/* called after every poll with the dest and the time spent */
+	Progress func(d *Vs_dest_user_r, elapsed time.Duration)
+}
+
+func (opts *Drain_options) drained(d *Vs_dest_user_r) bool {
+	return d.Activeconns == 0 &&
+		(!opts.Inactive || d.Inactconns == 0) &&
+		(!opts.Persistent || d.Persistent == 0)
+}
+
+func (c *Client) Drain_dest(o *CmdOptions, opts *Drain_options) (*Vs_dest_user_r, error) {
+	return c.Drain_dest_ctx(context.Background(), o, opts)
+}
+
+/*
+ * Drain_dest_ctx sets the weight of the dest o.Daddr to 0, keeping
+ * its forwarding method and thresholds, so it takes no new
+ * connections, then polls it until its active connections, and the
+ * inactive ones and persistence templates if asked, are gone, and
+ * deletes it with opts.Delete. It returns the last dest read, with
+ * ErrDrainTimeout after opts.Timeout, the dest is left at weight 0.
+ */
+func (c *Client) Drain_dest_ctx(ctx context.Context, o *CmdOptions, opts *Drain_options) (*Vs_dest_user_r, error) {
+	if opts == nil {
+		opts = &Drain_options{}
+	}
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = DRAIN_INTERVAL
+	}
+
+	d, err := c.find_dest(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+	if d.Weight != 0 {
+		var reply Vs_cmd_r
+		args := Vs_dest_q{Cmd: VS_CMD_SET_DEST, Service: service_key(o), Dest: dest_user(d)}
+		args.Dest.Weight = 0
+		if err := c.call(ctx, "api", args, &reply); err != nil {
+			return d, err
+		}
+		d.Weight = 0
+	}
+
+	start := time.Now()
+	var deadline <-chan time.Time
+	if opts.Timeout > 0 {
+		t := time.NewTimer(opts.Timeout)
+		defer t.Stop()
+		deadline = t.C
+	}
+	tick := time.NewTicker(interval)
+	defer tick.Stop()
+
+	for {
+		if opts.Progress != nil {
+			opts.Progress(d, time.Since(start))
+		}
+		if opts.drained(d) {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return d, ctx_err(ctx)
+		case <-deadline:
+			return d, ErrDrainTimeout
+		case <-tick.C:
+		}
+		if d, err = c.find_dest(ctx, o); err != nil {
+			return nil, err
+		}
+	}
+
+	if opts.Delete {
+		if _, err := c.Set_deldest_ctx(ctx, o); err != nil {
+			return d, err
+		}
+	}
+	return d, nil
+}
+
+func Drain_dest(o *CmdOptions, opts *Drain_options) (*Vs_dest_user_r, error) {
+	return DefaultClient.Drain_dest(o, opts)
+}
+
+func Drain_dest_ctx(ctx context.Context, o *CmdOptions, opts *Drain_options) (*Vs_dest_user_r, error) {
+	return DefaultClient.Drain_dest_ctx(ctx, o, opts)
+}
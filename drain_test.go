@@ -0,0 +1,124 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/yubo/govs"
+	"github.com/yubo/govs/govstest"
+)
+
+// drain_setup adds a dr dest of weight 10 with active connections
+func drain_setup(t *testing.T, active uint32) (*govstest.Server, *govs.Client, *govs.CmdOptions) {
+	t.Helper()
+	s, err := govstest.NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := s.Client()
+	t.Cleanup(func() {
+		c.Close()
+		s.Close()
+	})
+
+	o := &govs.CmdOptions{Protocol: govs.IPPROTO_TCP, Sched_name: "wrr",
+		Weight: 10, Fwd: govs.FWD_DR}
+	if err := o.Addr.Set("10.0.0.1:80"); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Daddr.Set("192.168.1.2:80"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Set_add(o); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Set_adddest(o); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Set_dest_conns(govs.IPPROTO_TCP, o.Addr, o.Daddr, active, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	return s, c, o
+}
+
+func get_dest(t *testing.T, c *govs.Client, o *govs.CmdOptions) *govs.Vs_dest_user_r {
+	t.Helper()
+	dests, err := c.Get_dests(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range dests.Dests {
+		if d := &dests.Dests[i]; d.Address() == o.Daddr {
+			return d
+		}
+	}
+	return nil
+}
+
+func TestDrain_dest(t *testing.T) {
+	s, c, o := drain_setup(t, 3)
+
+	/* the data plane closes one connection between two polls */
+	var polls []uint32
+	opts := &govs.Drain_options{Interval: time.Millisecond, Timeout: 10 * time.Second,
+		Progress: func(d *govs.Vs_dest_user_r, elapsed time.Duration) {
+			polls = append(polls, d.Activeconns)
+			if d.Weight != 0 {
+				t.Errorf("poll %d: weight %d, want 0", len(polls), d.Weight)
+			}
+			if d.Activeconns > 0 {
+				s.Set_dest_conns(govs.IPPROTO_TCP, o.Addr, o.Daddr, d.Activeconns-1, 0, 0)
+			}
+		}}
+
+	d, err := c.Drain_dest_ctx(context.Background(), o, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(polls) != 4 || polls[3] != 0 || d.Activeconns != 0 {
+		t.Errorf("polls %v, last %+v", polls, d)
+	}
+	d = get_dest(t, c, o)
+	if d == nil || d.Weight != 0 || d.Conn_flags&govs.VS_CONN_F_FWD_MASK != govs.VS_CONN_F_DROUTE {
+		t.Errorf("drained dest %+v, want a dr dest of weight 0", d)
+	}
+
+	opts.Delete, opts.Progress = true, nil
+	if _, err := c.Drain_dest_ctx(context.Background(), o, opts); err != nil {
+		t.Fatal(err)
+	}
+	if d := get_dest(t, c, o); d != nil {
+		t.Errorf("dest %+v not deleted", d)
+	}
+}
+
+func TestDrain_dest_timeout(t *testing.T) {
+	_, c, o := drain_setup(t, 1)
+
+	opts := &govs.Drain_options{Interval: time.Millisecond,
+		Timeout: 20 * time.Millisecond, Delete: true}
+	d, err := c.Drain_dest_ctx(context.Background(), o, opts)
+	if !errors.Is(err, govs.ErrDrainTimeout) || d == nil || d.Activeconns != 1 {
+		t.Fatalf("got %+v, %v, want ErrDrainTimeout", d, err)
+	}
+	if d := get_dest(t, c, o); d == nil || d.Weight != 0 {
+		t.Errorf("dest %+v, want it left at weight 0", d)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	opts.Timeout = 0
+	if _, err := c.Drain_dest_ctx(ctx, o, opts); !errors.Is(err, govs.ErrTimeout) ||
+		!errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("ctx deadline: %v, want ErrTimeout", err)
+	}
+}
@@ -0,0 +1,117 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+)
+
+/*
+ * dpvs endpoints
+ *
+ *   /tmp/dpvs.sock, unix:///tmp/dpvs.sock   local unix socket
+ *   tcp://10.0.0.1:6000                     plain tcp, e.g. to a govs proxy
+ *   tls://10.0.0.1:6000                     tcp with tls
+ */
+func Parse_endpoint(endpoint string) (network, addr string, err error) {
+	network, addr = "unix", endpoint
+	if i := strings.Index(endpoint, "://"); i >= 0 {
+		network, addr = endpoint[:i], endpoint[i+3:]
+	}
+
+	switch network {
+	case "unix", "tcp", "tls":
+	default:
+		return "", "", errEndpoint
+	}
+	if addr == "" {
+		return "", "", errEndpoint
+	}
+	return network, addr, nil
+}
+
+// Endpoint_dialer returns a dialer for endpoint, config is only
+// used by tls endpoints, nil means the default tls settings.
+func Endpoint_dialer(endpoint string, config *tls.Config) (Dialer, error) {
+	network, addr, err := Parse_endpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	if network == "tls" {
+		d := &tls.Dialer{Config: config}
+		return func(ctx context.Context) (net.Conn, error) {
+			return d.DialContext(ctx, "tcp", addr)
+		}, nil
+	}
+
+	return func(ctx context.Context) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, network, addr)
+	}, nil
+}
+
+// Tls_config loads the CA used to verify the peer and, for mutual
+// tls, the local certificate. Empty file names are skipped.
+func Tls_config(ca, cert, key string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if ca != "" {
+		pem, err := os.ReadFile(ca)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%s: no certificate found", ca)
+		}
+		config.RootCAs = pool
+		config.ClientCAs = pool
+	}
+
+	if cert != "" || key != "" {
+		c, err := tls.LoadX509KeyPair(cert, key)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{c}
+	}
+	return config, nil
+}
+
+// Set_endpoint makes the next dial use endpoint, the current
+// connection is closed.
+func (c *Client) Set_endpoint(endpoint string, config *tls.Config) error {
+	dial, err := Endpoint_dialer(endpoint, config)
+	if err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.dial = dial
+	if c.rpc != nil {
+		c.rpc.Close()
+		c.rpc = nil
+	}
+	return nil
+}
+
+// Vs_dial_endpoint connects DefaultClient to endpoint.
+func Vs_dial_endpoint(endpoint string, config *tls.Config) error {
+	if err := DefaultClient.Set_endpoint(endpoint, config); err != nil {
+		return err
+	}
+	return DefaultClient.Dial()
+}
@@ -0,0 +1,316 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs
+
+import (
+	"strconv"
+	"strings"
+)
+
+type flag_name struct {
+	flag uint
+	name string
+}
+
+var (
+	svc_flag_names = []flag_name{
+		{VS_SVC_F_PERSISTENT, "persistent"},
+		{VS_SVC_F_HASHED, "hashed"},
+		{VS_SVC_F_ONEPACKET, "onepacket"},
+		{VS_SVC_F_DSNAT, "dsnat"},
+		{VS_SVC_F_SYNPROXY, "synproxy"},
+	}
+
+	/* values of VS_CONN_F_FWD_MASK */
+	conn_fwd_names = []flag_name{
+		{VS_CONN_F_MASQ, "masq"},
+		{VS_CONN_F_LOCALNODE, "localnode"},
+		{VS_CONN_F_TUNNEL, "tunnel"},
+		{VS_CONN_F_DROUTE, "droute"},
+		{VS_CONN_F_BYPASS, "bypass"},
+		{VS_CONN_F_FULLNAT, "fullnat"},
+	}
+
+	conn_flag_names = []flag_name{
+		{VS_CONN_F_DSNAT, "dsnat"},
+		{VS_CONN_F_SYNC, "sync"},
+		{VS_CONN_F_HASHED, "hashed"},
+		{VS_CONN_F_NOOUTPUT, "nooutput"},
+		{VS_CONN_F_INACTIVE, "inactive"},
+		{VS_CONN_F_OUT_SEQ, "out_seq"},
+		{VS_CONN_F_IN_SEQ, "in_seq"},
+		{VS_CONN_F_NO_CPORT, "no_cport"},
+		{VS_CONN_F_TEMPLATE, "template"},
+		{VS_CONN_F_ONE_PACKET, "one_packet"},
+		{VS_CONN_F_SYNPROXY, "synproxy"},
+	}
+
+	conn_fwd_aliases = map[string]uint{
+		"nat": VS_CONN_F_MASQ,
+		"dr":  VS_CONN_F_DROUTE,
+	}
+)
+
+/* VS_CONN_F_DSNAT is within VS_CONN_F_FWD_MASK */
+const conn_fwd_mask = VS_CONN_F_FWD_MASK &^ VS_CONN_F_DSNAT
+
+func conn_flags_mask() (mask uint) {
+	mask = conn_fwd_mask
+	for _, f := range conn_flag_names {
+		mask |= f.flag
+	}
+	return mask
+}
+
+// split_flags splits "a,b" or "a|b"
+func split_flags(value string) []string {
+	return strings.FieldsFunc(strings.ToLower(value), func(r rune) bool {
+		return r == ',' || r == '|' || r == ' '
+	})
+}
+
+// join_flags renders the names of the bits set in flags, the bits
+// without a name in hex
+func join_flags(flags uint, names []flag_name, s []string) string {
+	for _, f := range names {
+		if flags&f.flag != 0 {
+			s = append(s, strings.ToUpper(f.name))
+			flags &^= f.flag
+		}
+	}
+	if flags != 0 {
+		s = append(s, "0x"+strconv.FormatUint(uint64(flags), 16))
+	}
+	if len(s) == 0 {
+		return "-"
+	}
+	return strings.Join(s, "|")
+}
+
+// SvcFlags are the VS_SVC_F_* flags of a service
+type SvcFlags uint
+
+/*
+ * persistent,synproxy, PERSISTENT|SYNPROXY or a number,
+ * only the flags of VS_SVC_F_MASK can be set
+ */
+func (p *SvcFlags) Set(value string) error {
+	var flags uint
+
+	if n, err := strconv.ParseUint(value, 0, 32); err == nil {
+		flags = uint(n)
+	} else {
+	next:
+		for _, name := range split_flags(value) {
+			for _, f := range svc_flag_names {
+				if f.name == name {
+					flags |= f.flag
+					continue next
+				}
+			}
+			return errSvcFlags
+		}
+	}
+
+	if flags&^VS_SVC_F_MASK != 0 {
+		return errSvcFlags
+	}
+	*p = SvcFlags(flags)
+	return nil
+}
+
+func (p SvcFlags) String() string {
+	return join_flags(uint(p), svc_flag_names, nil)
+}
+
+// MarshalText leaves out the flags dpvs sets itself, no flags is ""
+func (p SvcFlags) MarshalText() ([]byte, error) {
+	if p&VS_SVC_F_MASK == 0 {
+		return []byte{}, nil
+	}
+	return []byte(strings.ToLower((p & VS_SVC_F_MASK).String())), nil
+}
+
+func (p *SvcFlags) UnmarshalText(text []byte) error {
+	return p.Set(string(text))
+}
+
+// ConnFlags are the VS_CONN_F_* flags of a dest or connection, the
+// forwarding method comes first in String
+type ConnFlags uint
+
+/*
+ * fullnat,synproxy, FULLNAT|SYNPROXY or a number, at most one
+ * forwarding method. masq is 0, no method at all to dest_conn_flags,
+ * so it is refused, NAT is set with Fwd.
+ */
+func (p *ConnFlags) Set(value string) error {
+	var flags uint
+
+	if n, err := strconv.ParseUint(value, 0, 32); err == nil {
+		flags = uint(n)
+	} else {
+		fwd := false
+	next:
+		for _, name := range split_flags(value) {
+			if f, ok := conn_fwd(name); ok {
+				if f == VS_CONN_F_MASQ {
+					return errConnMasq
+				}
+				if fwd {
+					return errConnFlags
+				}
+				fwd = true
+				flags |= f
+				continue
+			}
+			for _, f := range conn_flag_names {
+				if f.name == name {
+					flags |= f.flag
+					continue next
+				}
+			}
+			return errConnFlags
+		}
+	}
+
+	if flags&^conn_flags_mask() != 0 {
+		return errConnFlags
+	}
+	*p = ConnFlags(flags)
+	return nil
+}
+
+func conn_fwd(name string) (uint, bool) {
+	if f, ok := conn_fwd_aliases[name]; ok {
+		return f, true
+	}
+	for _, f := range conn_fwd_names {
+		if f.name == name {
+			return f.flag, true
+		}
+	}
+	return 0, false
+}
+
+func (p ConnFlags) String() string {
+	var s []string
+
+	/* no method, masq, is left out as Set refuses it */
+	fwd := uint(p) & conn_fwd_mask
+	for _, f := range conn_fwd_names {
+		if fwd != VS_CONN_F_MASQ && f.flag == fwd {
+			s = append(s, strings.ToUpper(f.name))
+			fwd = 0
+			break
+		}
+	}
+	if fwd != 0 {
+		s = append(s, "FWD"+strconv.FormatUint(uint64(fwd), 10))
+	}
+	return join_flags(uint(p)&^conn_fwd_mask, conn_flag_names, s)
+}
+
+// MarshalText falls back to a number for the flags without a name
+func (p ConnFlags) MarshalText() ([]byte, error) {
+	if fwd := uint(p) & conn_fwd_mask; fwd > VS_CONN_F_FULLNAT ||
+		uint(p)&^conn_flags_mask() != 0 {
+		return []byte("0x" + strconv.FormatUint(uint64(p), 16)), nil
+	}
+	if p == 0 {
+		return []byte{}, nil
+	}
+	return []byte(strings.ToLower(p.String())), nil
+}
+
+func (p *ConnFlags) UnmarshalText(text []byte) error {
+	return p.Set(string(text))
+}
+
+// Fwd is the forwarding method of a dest, the zero Fwd is unset:
+// FULLNAT for a new dest, the method of the dest for an edit
+type Fwd int
+
+const (
+	FWD_UNSET Fwd = iota
+	FWD_FULLNAT
+	FWD_DR
+	FWD_TUNNEL
+	FWD_NAT
+	FWD_DSNAT
+)
+
+var (
+	fwd_names = []flag_name{
+		FWD_UNSET:   {VS_CONN_F_FULLNAT, ""},
+		FWD_FULLNAT: {VS_CONN_F_FULLNAT, "fullnat"},
+		FWD_DR:      {VS_CONN_F_DROUTE, "dr"},
+		FWD_TUNNEL:  {VS_CONN_F_TUNNEL, "tunnel"},
+		FWD_NAT:     {VS_CONN_F_MASQ, "nat"},
+		FWD_DSNAT:   {VS_CONN_F_DSNAT, "dsnat"},
+	}
+
+	fwd_aliases = map[string]Fwd{
+		"droute": FWD_DR,
+		"masq":   FWD_NAT,
+	}
+)
+
+func (p *Fwd) Set(value string) error {
+	value = strings.ToLower(value)
+	if f, ok := fwd_aliases[value]; ok {
+		*p = f
+		return nil
+	}
+	for i := FWD_FULLNAT; int(i) < len(fwd_names); i++ {
+		if fwd_names[i].name == value {
+			*p = i
+			return nil
+		}
+	}
+	return errFwd
+}
+
+func (p Fwd) String() string {
+	if p < 0 || int(p) >= len(fwd_names) {
+		return "fwd" + strconv.Itoa(int(p))
+	}
+	return fwd_names[p].name
+}
+
+// Conn_flags returns the VS_CONN_F_* value of the method, FULLNAT
+// for FWD_UNSET
+func (p Fwd) Conn_flags() uint {
+	if p < 0 || int(p) >= len(fwd_names) {
+		return VS_CONN_F_FULLNAT
+	}
+	return fwd_names[p].flag
+}
+
+func (p Fwd) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Fwd) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*p = FWD_UNSET
+		return nil
+	}
+	return p.Set(string(text))
+}
+
+// Conn_fwd finds the forwarding method of the conn flags of a dest
+func Conn_fwd(conn_flags uint) (Fwd, bool) {
+	fwd := conn_flags & VS_CONN_F_FWD_MASK
+	for i := FWD_FULLNAT; int(i) < len(fwd_names); i++ {
+		if fwd_names[i].flag == fwd {
+			return i, true
+		}
+	}
+	return FWD_UNSET, false
+}
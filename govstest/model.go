@@ -0,0 +1,490 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govstest
+
+import (
+	"errors"
+
+	"github.com/yubo/govs"
+)
+
+const (
+	VERSION    = 0x010200 /* 1.2.0 */
+	CONN_TABLE = 1 << 20
+)
+
+var (
+	errMethod = errors.New("rpc: can't find method")
+
+	scheds = map[string]bool{
+		"rr": true, "wrr": true, "lc": true, "wlc": true,
+		"sed": true, "nq": true, "sh": true, "dh": true, "mh": true,
+	}
+
+	/* what dpvs 1.2.0 balances */
+	protocols = map[uint8]bool{
+		govs.IPPROTO_TCP: true, govs.IPPROTO_UDP: true,
+		govs.IPPROTO_SCTP: true, govs.IPPROTO_ICMP: true,
+		govs.IPPROTO_ICMPV6: true,
+	}
+)
+
+// api_q is the union of all the "api" requests
+type api_q struct {
+	Cmd             int
+	Service         govs.Vs_service_user
+	Dest            govs.Vs_dest_user
+	Laddr           govs.Vs_laddr_user
+	Tcp_timeout     int
+	Tcp_fin_timeout int
+	Udp_timeout     int
+	Daemon          govs.Vs_daemon_user
+}
+
+type service struct {
+	govs.Vs_service_user_r
+	dests  []govs.Vs_dest_user_r
+	laddrs []govs.Vs_laddr_user_r
+}
+
+type model struct {
+	seq      int
+	services []*service
+	timeout  govs.Vs_timeout_user
+	daemons  []govs.Vs_daemon_user /* master first */
+}
+
+func new_model() *model {
+	return &model{
+		timeout: govs.Vs_timeout_user{
+			Tcp_timeout:     900,
+			Tcp_fin_timeout: 120,
+			Udp_timeout:     300,
+		},
+	}
+}
+
+// dpvs returns negative errno
+func cmd_r(code int, msg string) govs.Vs_cmd_r {
+	return govs.Vs_cmd_r{Code: -code, Msg: msg}
+}
+
+func (m *model) find(u *govs.Vs_service_user) (int, *service) {
+	for i, svc := range m.services {
+		if svc.Protocol == u.Protocol && svc.Addr == u.Addr &&
+			svc.Addr6 == u.Addr6 && svc.Port == u.Port {
+			return i, svc
+		}
+	}
+	return -1, nil
+}
+
+func (svc *service) find_dest(u *govs.Vs_dest_user) int {
+	for i, d := range svc.dests {
+		if d.Addr == u.Addr && d.Addr6 == u.Addr6 && d.Port == u.Port {
+			return i
+		}
+	}
+	return -1
+}
+
+func (svc *service) find_laddr(u *govs.Vs_laddr_user) int {
+	for i, l := range svc.laddrs {
+		if l.Addr == u.Addr && l.Addr6 == u.Addr6 {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *model) api(q *api_q) interface{} {
+	/* ipv4 requests come without Af */
+	for _, af := range []*uint16{&q.Service.Af, &q.Dest.Af, &q.Laddr.Af} {
+		if *af == 0 {
+			*af = govs.AF_INET
+		}
+	}
+
+	switch q.Cmd {
+	case govs.VS_CMD_GET_INFO:
+		return govs.Vs_version_r{Version: VERSION, Size: CONN_TABLE}
+	case govs.VS_CMD_GET_CONFIG:
+		return govs.Vs_timeout_r{
+			Tcp_timeout:     m.timeout.Tcp_timeout,
+			Tcp_fin_timeout: m.timeout.Tcp_fin_timeout,
+			Udp_timeout:     m.timeout.Udp_timeout,
+		}
+	case govs.VS_CMD_SET_CONFIG:
+		return m.set_config(q)
+	case govs.VS_CMD_FLUSH:
+		m.services = nil
+		m.seq++
+		return govs.Vs_cmd_r{}
+	case govs.VS_CMD_ZERO:
+		return m.zero(q)
+	case govs.VS_CMD_GET_SERVICES:
+		return m.get_services(q)
+	case govs.VS_CMD_GET_SERVICE:
+		return m.get_service(q)
+	case govs.VS_CMD_NEW_SERVICE:
+		return m.new_service(q)
+	case govs.VS_CMD_SET_SERVICE:
+		return m.set_service(q)
+	case govs.VS_CMD_DEL_SERVICE:
+		return m.del_service(q)
+	case govs.VS_CMD_GET_DEST:
+		return m.get_dests(q)
+	case govs.VS_CMD_NEW_DEST:
+		return m.new_dest(q)
+	case govs.VS_CMD_SET_DEST:
+		return m.set_dest(q)
+	case govs.VS_CMD_DEL_DEST:
+		return m.del_dest(q)
+	case govs.VS_CMD_GET_LADDR:
+		return m.get_laddrs(q)
+	case govs.VS_CMD_NEW_LADDR:
+		return m.new_laddr(q)
+	case govs.VS_CMD_DEL_LADDR:
+		return m.del_laddr(q)
+	case govs.VS_CMD_GET_DAEMON:
+		return govs.Vs_daemon_r{Daemons: append([]govs.Vs_daemon_user{}, m.daemons...)}
+	case govs.VS_CMD_NEW_DAEMON:
+		return m.new_daemon(q)
+	case govs.VS_CMD_DEL_DAEMON:
+		return m.del_daemon(q)
+	}
+	return cmd_r(govs.EINVAL, "unsupported command")
+}
+
+func (m *model) set_config(q *api_q) interface{} {
+	if q.Tcp_timeout <= 0 || q.Tcp_fin_timeout <= 0 || q.Udp_timeout <= 0 {
+		return cmd_r(govs.EINVAL, "timeout must be positive")
+	}
+	m.timeout = govs.Vs_timeout_user{
+		Tcp_timeout:     q.Tcp_timeout,
+		Tcp_fin_timeout: q.Tcp_fin_timeout,
+		Udp_timeout:     q.Udp_timeout,
+	}
+	return govs.Vs_cmd_r{}
+}
+
+func (m *model) zero(q *api_q) interface{} {
+	zero := func(svc *service) {
+		svc.Conns, svc.Inpkts, svc.Outpkts = 0, 0, 0
+		svc.Inbytes, svc.Outbytes = 0, 0
+		for i := range svc.dests {
+			d := &svc.dests[i]
+			d.Conns, d.Inpkts, d.Outpkts = 0, 0, 0
+			d.Inbytes, d.Outbytes = 0, 0
+		}
+	}
+
+	if q.Service.Addr == 0 && q.Service.Addr6.Is_zero() {
+		for _, svc := range m.services {
+			zero(svc)
+		}
+		return govs.Vs_cmd_r{}
+	}
+
+	_, svc := m.find(&q.Service)
+	if svc == nil {
+		return cmd_r(govs.ENOENT, "service not exist")
+	}
+	zero(svc)
+	return govs.Vs_cmd_r{}
+}
+
+func (m *model) get_services(q *api_q) interface{} {
+	r := govs.Vs_list_services_r{Num_services: len(m.services)}
+	for _, svc := range m.services {
+		r.Services = append(r.Services, svc.Vs_service_user_r)
+	}
+	return r
+}
+
+func (m *model) get_service(q *api_q) interface{} {
+	_, svc := m.find(&q.Service)
+	if svc == nil {
+		return govs.Vs_list_service_r{Code: -govs.ENOENT, Msg: "service not exist"}
+	}
+	return govs.Vs_list_service_r{Service: svc.Vs_service_user_r}
+}
+
+// check_af checks the address of the family af is set
+func check_af(af uint16, addr govs.Be32, addr6 govs.In6_addr) bool {
+	switch af {
+	case govs.AF_INET:
+		return addr != 0 && addr6.Is_zero()
+	case govs.AF_INET6:
+		return addr == 0 && !addr6.Is_zero()
+	}
+	return false
+}
+
+func check_service(u *govs.Vs_service_user) (int, string) {
+	if !check_af(u.Af, u.Addr, u.Addr6) {
+		return govs.EINVAL, "invalid service address"
+	}
+	if !protocols[u.Protocol] {
+		return govs.EPROTONOSUPPORT, "protocol not supported"
+	}
+	if !scheds[u.Sched_name] {
+		return govs.ENOENT, "scheduler not found"
+	}
+	if u.Flags&^govs.VS_SVC_F_MASK != 0 {
+		return govs.EINVAL, "invalid service flags"
+	}
+	return 0, ""
+}
+
+func sched_table(u *govs.Vs_service_user) uint32 {
+	if u.Sched_name == "mh" && u.Sched_table == 0 {
+		return govs.MH_TABLE_SIZE
+	}
+	return u.Sched_table
+}
+
+func (m *model) new_service(q *api_q) interface{} {
+	u := &q.Service
+	if code, msg := check_service(u); code != 0 {
+		return cmd_r(code, msg)
+	}
+	if _, svc := m.find(u); svc != nil {
+		return cmd_r(govs.EEXIST, "service already exist")
+	}
+
+	m.services = append(m.services, &service{
+		Vs_service_user_r: govs.Vs_service_user_r{
+			Af:          u.Af,
+			Protocol:    u.Protocol,
+			Addr:        u.Addr,
+			Addr6:       u.Addr6,
+			Port:        u.Port,
+			Sched_name:  u.Sched_name,
+			Sched_flags: uint32(u.Sched_flags),
+			Sched_table: sched_table(u),
+			Flags:       uint32(u.Flags),
+			Timeout:     uint32(u.Timeout),
+			Netmask:     u.Netmask,
+		},
+	})
+	m.seq++
+	return govs.Vs_cmd_r{}
+}
+
+func (m *model) set_service(q *api_q) interface{} {
+	u := &q.Service
+	_, svc := m.find(u)
+	if svc == nil {
+		return cmd_r(govs.ENOENT, "service not exist")
+	}
+	if code, msg := check_service(u); code != 0 {
+		return cmd_r(code, msg)
+	}
+
+	svc.Sched_name = u.Sched_name
+	svc.Sched_flags = uint32(u.Sched_flags)
+	svc.Sched_table = sched_table(u)
+	svc.Flags = uint32(u.Flags)
+	svc.Timeout = uint32(u.Timeout)
+	svc.Netmask = u.Netmask
+	m.seq++
+	return govs.Vs_cmd_r{}
+}
+
+func (m *model) del_service(q *api_q) interface{} {
+	i, svc := m.find(&q.Service)
+	if svc == nil {
+		return cmd_r(govs.ENOENT, "service not exist")
+	}
+
+	m.services = append(m.services[:i], m.services[i+1:]...)
+	m.seq++
+	return govs.Vs_cmd_r{}
+}
+
+func (m *model) get_dests(q *api_q) interface{} {
+	_, svc := m.find(&q.Service)
+	if svc == nil {
+		return govs.Vs_list_dests_r{Code: -govs.ENOENT, Msg: "service not exist"}
+	}
+
+	dests := svc.dests
+	if n := q.Service.Number; n > 0 && n < len(dests) {
+		dests = dests[:n]
+	}
+	return govs.Vs_list_dests_r{Dests: append([]govs.Vs_dest_user_r{}, dests...)}
+}
+
+func check_dest(u *govs.Vs_dest_user) (int, string) {
+	if !check_af(u.Af, u.Addr, u.Addr6) {
+		return govs.EINVAL, "invalid dest address"
+	}
+	if u.Weight < 0 {
+		return govs.EINVAL, "invalid weight"
+	}
+	if u.U_threshold != 0 && u.L_threshold > u.U_threshold {
+		return govs.EINVAL, "lower threshold is above the upper one"
+	}
+	return 0, ""
+}
+
+func (m *model) new_dest(q *api_q) interface{} {
+	_, svc := m.find(&q.Service)
+	if svc == nil {
+		return cmd_r(govs.ENOENT, "service not exist")
+	}
+	u := &q.Dest
+	if code, msg := check_dest(u); code != 0 {
+		return cmd_r(code, msg)
+	}
+	if svc.find_dest(u) >= 0 {
+		return cmd_r(govs.EEXIST, "dest already exist")
+	}
+
+	svc.dests = append(svc.dests, govs.Vs_dest_user_r{
+		Af:          u.Af,
+		Addr:        u.Addr,
+		Addr6:       u.Addr6,
+		Port:        u.Port,
+		Conn_flags:  u.Conn_flags,
+		Weight:      u.Weight,
+		U_threshold: u.U_threshold,
+		L_threshold: u.L_threshold,
+	})
+	svc.Num_dests = uint32(len(svc.dests))
+	m.seq++
+	return govs.Vs_cmd_r{}
+}
+
+func (m *model) set_dest(q *api_q) interface{} {
+	_, svc := m.find(&q.Service)
+	if svc == nil {
+		return cmd_r(govs.ENOENT, "service not exist")
+	}
+	u := &q.Dest
+	i := svc.find_dest(u)
+	if i < 0 {
+		return cmd_r(govs.ENOENT, "dest not exist")
+	}
+	if code, msg := check_dest(u); code != 0 {
+		return cmd_r(code, msg)
+	}
+
+	d := &svc.dests[i]
+	d.Conn_flags = u.Conn_flags
+	d.Weight = u.Weight
+	d.U_threshold = u.U_threshold
+	d.L_threshold = u.L_threshold
+	m.seq++
+	return govs.Vs_cmd_r{}
+}
+
+func (m *model) del_dest(q *api_q) interface{} {
+	_, svc := m.find(&q.Service)
+	if svc == nil {
+		return cmd_r(govs.ENOENT, "service not exist")
+	}
+	i := svc.find_dest(&q.Dest)
+	if i < 0 {
+		return cmd_r(govs.ENOENT, "dest not exist")
+	}
+
+	svc.dests = append(svc.dests[:i], svc.dests[i+1:]...)
+	svc.Num_dests = uint32(len(svc.dests))
+	m.seq++
+	return govs.Vs_cmd_r{}
+}
+
+func (m *model) get_laddrs(q *api_q) interface{} {
+	_, svc := m.find(&q.Service)
+	if svc == nil {
+		return govs.Vs_list_laddrs_r{Code: -govs.ENOENT, Msg: "service not exist"}
+	}
+
+	laddrs := svc.laddrs
+	if n := q.Service.Number; n > 0 && n < len(laddrs) {
+		laddrs = laddrs[:n]
+	}
+	return govs.Vs_list_laddrs_r{Laddrs: append([]govs.Vs_laddr_user_r{}, laddrs...)}
+}
+
+func (m *model) new_laddr(q *api_q) interface{} {
+	_, svc := m.find(&q.Service)
+	if svc == nil {
+		return cmd_r(govs.ENOENT, "service not exist")
+	}
+	u := &q.Laddr
+	if !check_af(u.Af, u.Addr, u.Addr6) {
+		return cmd_r(govs.EINVAL, "invalid local address")
+	}
+	if svc.find_laddr(u) >= 0 {
+		return cmd_r(govs.EEXIST, "local address already exist")
+	}
+
+	svc.laddrs = append(svc.laddrs, govs.Vs_laddr_user_r{
+		Af:    u.Af,
+		Addr:  u.Addr,
+		Addr6: u.Addr6,
+	})
+	svc.Num_laddrs = uint32(len(svc.laddrs))
+	m.seq++
+	return govs.Vs_cmd_r{}
+}
+
+func (m *model) del_laddr(q *api_q) interface{} {
+	_, svc := m.find(&q.Service)
+	if svc == nil {
+		return cmd_r(govs.ENOENT, "service not exist")
+	}
+	i := svc.find_laddr(&q.Laddr)
+	if i < 0 {
+		return cmd_r(govs.ENOENT, "local address not exist")
+	}
+
+	svc.laddrs = append(svc.laddrs[:i], svc.laddrs[i+1:]...)
+	svc.Num_laddrs = uint32(len(svc.laddrs))
+	m.seq++
+	return govs.Vs_cmd_r{}
+}
+
+func (m *model) find_daemon(state govs.Sync_state) int {
+	for i, d := range m.daemons {
+		if d.State == state {
+			return i
+		}
+	}
+	return -1
+}
+
+func (m *model) new_daemon(q *api_q) interface{} {
+	d := q.Daemon
+	if d.State != govs.VS_STATE_MASTER && d.State != govs.VS_STATE_BACKUP {
+		return cmd_r(govs.EINVAL, "invalid daemon state")
+	}
+	if d.Mcast_ifn == "" || d.Syncid < 0 || d.Syncid > govs.VS_SYNCID_MAX {
+		return cmd_r(govs.EINVAL, "invalid mcast interface or sync id")
+	}
+	if m.find_daemon(d.State) >= 0 {
+		return cmd_r(govs.EEXIST, "daemon already running")
+	}
+	m.daemons = append(m.daemons, d)
+	if d.State == govs.VS_STATE_MASTER && len(m.daemons) == 2 {
+		m.daemons[0], m.daemons[1] = m.daemons[1], m.daemons[0]
+	}
+	return govs.Vs_cmd_r{}
+}
+
+func (m *model) del_daemon(q *api_q) interface{} {
+	i := m.find_daemon(q.Daemon.State)
+	if i < 0 {
+		return cmd_r(govs.ESRCH, "daemon not running")
+	}
+	m.daemons = append(m.daemons[:i], m.daemons[i+1:]...)
+	return govs.Vs_cmd_r{}
+}
@@ -0,0 +1,214 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+
+// Package govstest provides an in-process fake dpvs for testing
+// code built on govs without a dpvs data plane.
+//
+//	s, err := govstest.NewServer()
+//	if err != nil {
+//		t.Fatal(err)
+//	}
+//	defer s.Close()
+//
+//	c := s.Client()
+//	c.Set_add(&govs.CmdOptions{...})
+//
+// or, in a test, c := govstest.NewClient(t).
+//
+// The server speaks the dpvs json-rpc protocol on a unix socket in
+// a temporary directory, so the govs command can be pointed at it
+// with -socket s.Path.
+package govstest
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/yubo/govs"
+)
+
+type Server struct {
+	// Path of the unix socket
+	Path string
+
+	dir string
+	l   net.Listener
+	wg  sync.WaitGroup
+
+	mu    sync.Mutex
+	conns map[net.Conn]bool
+	vs    *model
+}
+
+type request struct {
+	Method string
+	Params [1]json.RawMessage
+	Id     *json.RawMessage
+}
+
+type response struct {
+	Id     *json.RawMessage `json:"id"`
+	Result interface{}      `json:"result"`
+	Error  interface{}      `json:"error"`
+}
+
+// NewServer starts a fake dpvs with an empty configuration.
+func NewServer() (*Server, error) {
+	dir, err := os.MkdirTemp("", "govstest")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		Path:  filepath.Join(dir, "dpvs.sock"),
+		dir:   dir,
+		conns: make(map[net.Conn]bool),
+		vs:    new_model(),
+	}
+
+	if s.l, err = net.Listen("unix", s.Path); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	s.wg.Add(1)
+	go s.serve()
+	return s, nil
+}
+
+// Client returns a new client connected to s.
+func (s *Server) Client() *govs.Client {
+	return govs.NewClient(s.Path)
+}
+
+// NewClient starts a fake dpvs for the test t and returns a client
+// connected to it, both are closed when t ends.
+func NewClient(t testing.TB) *govs.Client {
+	t.Helper()
+	s, err := NewServer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := s.Client()
+	t.Cleanup(func() {
+		c.Close()
+		s.Close()
+	})
+	return c
+}
+
+// Set_dest_conns sets the connection counters of the dest rs of the
+// service vip, the fake data plane keeps none of its own.
+func (s *Server) Set_dest_conns(protocol uint8, vip, rs govs.Inet_addr, active, inact, persistent uint32) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, svc := s.vs.find(&govs.Vs_service_user{Protocol: protocol,
+		Addr: vip.Ip, Addr6: vip.Ip6, Port: vip.Port})
+	if svc == nil {
+		return govs.ErrNotExist
+	}
+	i := svc.find_dest(&govs.Vs_dest_user{Addr: rs.Ip, Addr6: rs.Ip6, Port: rs.Port})
+	if i < 0 {
+		return govs.ErrNotExist
+	}
+
+	d := &svc.dests[i]
+	d.Activeconns, d.Inactconns, d.Persistent = active, inact, persistent
+	return nil
+}
+
+// Close stops the server and drops all client connections.
+func (s *Server) Close() error {
+	err := s.l.Close()
+
+	s.mu.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	os.RemoveAll(s.dir)
+	return err
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+
+	for {
+		c, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+
+		s.mu.Lock()
+		s.conns[c] = true
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serve_conn(c)
+	}
+}
+
+func (s *Server) serve_conn(c net.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+		s.wg.Done()
+	}()
+
+	dec := json.NewDecoder(bufio.NewReader(c))
+	enc := json.NewEncoder(c)
+	for {
+		var req request
+		if err := dec.Decode(&req); err != nil {
+			return
+		}
+
+		resp := response{Id: req.Id}
+		result, err := s.handle(req.Method, req.Params[0])
+		if err != nil {
+			resp.Error = err.Error()
+		} else {
+			resp.Result = result
+		}
+
+		if err := enc.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) handle(method string, params json.RawMessage) (interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	switch method {
+	case "api":
+		var q api_q
+		if err := json.Unmarshal(params, &q); err != nil {
+			return nil, err
+		}
+		return s.vs.api(&q), nil
+	case "stats":
+		var q govs.Vs_stats_q
+		if err := json.Unmarshal(params, &q); err != nil {
+			return nil, err
+		}
+		return s.vs.stats(&q), nil
+	}
+	return nil, errMethod
+}
@@ -0,0 +1,271 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govstest_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/yubo/govs"
+	"github.com/yubo/govs/govstest"
+)
+
+func inet_addr(t *testing.T, s string) govs.Inet_addr {
+	t.Helper()
+	var a govs.Inet_addr
+	if err := a.Set(s); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func service(t *testing.T, addr string) *govs.CmdOptions {
+	return &govs.CmdOptions{
+		Addr:       inet_addr(t, addr),
+		Protocol:   govs.IPPROTO_TCP,
+		Sched_name: "wrr",
+	}
+}
+
+// check_err checks err is the *govs.Error of cmd with errno code
+// which matches target
+func check_err(t *testing.T, err error, cmd, code int, target error) {
+	t.Helper()
+	var e *govs.Error
+	if !errors.As(err, &e) {
+		t.Fatalf("err %v, want a *govs.Error", err)
+	}
+	if e.Method != "api" || e.Cmd != cmd || int(e.Code) != -code {
+		t.Errorf("err %s: method %s cmd %d code %d, want api %d %d",
+			err, e.Method, e.Cmd, e.Code, cmd, -code)
+	}
+	if !errors.Is(err, target) {
+		t.Errorf("err %s does not match %v", err, target)
+	}
+}
+
+func TestService(t *testing.T) {
+	c := govstest.NewClient(t)
+	o := service(t, "10.0.0.1:80")
+
+	if _, err := c.Set_add(o); err != nil {
+		t.Fatal(err)
+	}
+	_, err := c.Set_add(o)
+	check_err(t, err, govs.VS_CMD_NEW_SERVICE, govs.EEXIST, govs.ErrExist)
+
+	o.Sched_name = "wlc"
+	o.Flags = govs.VS_SVC_F_PERSISTENT
+	o.Timeout = 300
+	if _, err := c.Set_edit(o); err != nil {
+		t.Fatal(err)
+	}
+	r, err := c.Get_service(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if svc := r.Service; svc.Sched_name != "wlc" ||
+		svc.Flags != govs.VS_SVC_F_PERSISTENT || svc.Timeout != 300 {
+		t.Errorf("service %+v, want wlc persistent 300", svc)
+	}
+
+	svcs, err := c.Get_services(&govs.CmdOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(svcs.Services) != 1 {
+		t.Errorf("%d services, want 1", len(svcs.Services))
+	}
+
+	if _, err := c.Set_del(o); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Get_service(o)
+	check_err(t, err, govs.VS_CMD_GET_SERVICE, govs.ENOENT, govs.ErrNotExist)
+	_, err = c.Set_del(o)
+	check_err(t, err, govs.VS_CMD_DEL_SERVICE, govs.ENOENT, govs.ErrNotExist)
+	_, err = c.Set_edit(o)
+	check_err(t, err, govs.VS_CMD_SET_SERVICE, govs.ENOENT, govs.ErrNotExist)
+}
+
+func TestService_invalid(t *testing.T) {
+	c := govstest.NewClient(t)
+
+	o := service(t, "10.0.0.1:80")
+	o.Flags = govs.VS_SVC_F_HASHED /* set by dpvs only */
+	_, err := c.Set_add(o)
+	check_err(t, err, govs.VS_CMD_NEW_SERVICE, govs.EINVAL, govs.ErrInvalid)
+
+	_, err = c.Set_add(&govs.CmdOptions{Protocol: govs.IPPROTO_TCP, Sched_name: "rr"})
+	check_err(t, err, govs.VS_CMD_NEW_SERVICE, govs.EINVAL, govs.ErrInvalid)
+}
+
+func TestDest(t *testing.T) {
+	c := govstest.NewClient(t)
+	o := service(t, "10.0.0.1:80")
+	if _, err := c.Set_add(o); err != nil {
+		t.Fatal(err)
+	}
+
+	o.Daddr = inet_addr(t, "192.168.1.2:8080")
+	o.Fwd = govs.FWD_DR
+	o.Weight = 10
+	if _, err := c.Set_adddest(o); err != nil {
+		t.Fatal(err)
+	}
+	_, err := c.Set_adddest(o)
+	check_err(t, err, govs.VS_CMD_NEW_DEST, govs.EEXIST, govs.ErrExist)
+
+	o.Weight = 5
+	o.U_threshold, o.L_threshold = 1000, 800
+	if _, err := c.Set_editdest(o); err != nil {
+		t.Fatal(err)
+	}
+	dests, err := c.Get_dests(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(dests.Dests) != 1 {
+		t.Fatalf("%d dests, want 1", len(dests.Dests))
+	}
+	d := dests.Dests[0]
+	if d.Address() != o.Daddr || d.Fwd() != "dr" || d.Weight != 5 ||
+		d.U_threshold != 1000 || d.L_threshold != 800 {
+		t.Errorf("dest %s %s weight %d %d-%d, want %s dr weight 5 800-1000",
+			d.Address(), d.Fwd(), d.Weight, d.L_threshold, d.U_threshold, o.Daddr)
+	}
+
+	o.L_threshold = 2000
+	_, err = c.Set_editdest(o)
+	check_err(t, err, govs.VS_CMD_SET_DEST, govs.EINVAL, govs.ErrInvalid)
+
+	if _, err := c.Set_deldest(o); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Set_deldest(o)
+	check_err(t, err, govs.VS_CMD_DEL_DEST, govs.ENOENT, govs.ErrNotExist)
+	_, err = c.Set_editdest(o)
+	check_err(t, err, govs.VS_CMD_SET_DEST, govs.ENOENT, govs.ErrNotExist)
+
+	o.Addr = inet_addr(t, "10.0.0.2:80")
+	_, err = c.Set_adddest(o)
+	check_err(t, err, govs.VS_CMD_NEW_DEST, govs.ENOENT, govs.ErrNotExist)
+	_, err = c.Get_dests(o)
+	check_err(t, err, govs.VS_CMD_GET_DEST, govs.ENOENT, govs.ErrNotExist)
+}
+
+func TestLaddr(t *testing.T) {
+	c := govstest.NewClient(t)
+	o := service(t, "[2001:db8::1]:443")
+	if _, err := c.Set_add(o); err != nil {
+		t.Fatal(err)
+	}
+
+	o.Lip = inet_addr(t, "2001:db8::100")
+	if _, err := c.Set_addladdr(o); err != nil {
+		t.Fatal(err)
+	}
+	_, err := c.Set_addladdr(o)
+	check_err(t, err, govs.VS_CMD_NEW_LADDR, govs.EEXIST, govs.ErrExist)
+
+	laddrs, err := c.Get_laddrs(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(laddrs.Laddrs) != 1 || laddrs.Laddrs[0].Address() != o.Lip {
+		t.Errorf("laddrs %v, want %s", laddrs, o.Lip)
+	}
+
+	if _, err := c.Set_delladdr(o); err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.Set_delladdr(o)
+	check_err(t, err, govs.VS_CMD_DEL_LADDR, govs.ENOENT, govs.ErrNotExist)
+}
+
+func TestError_is(t *testing.T) {
+	for _, e := range []struct {
+		code   int
+		target error
+		want   bool
+	}{
+		{govs.ENOENT, govs.ErrNotExist, true},
+		{govs.EEXIST, govs.ErrExist, true},
+		{govs.EINVAL, govs.ErrInvalid, true},
+		{govs.ENOENT, govs.ErrExist, false},
+		{govs.EEXIST, govs.ErrInvalid, false},
+		{govs.EPERM, govs.ErrNotExist, false},
+	} {
+		err := error(&govs.Error{Method: "api", Code: govs.Ecode(-e.code)})
+		if got := errors.Is(err, e.target); got != e.want {
+			t.Errorf("errors.Is(%s, %v) = %v, want %v", err, e.target, got, e.want)
+		}
+	}
+}
+
+// TestDest_keep_fwd edits the weight of dests without a forwarding
+// method, they keep theirs
+func TestDest_keep_fwd(t *testing.T) {
+	c := govstest.NewClient(t)
+	o := service(t, "10.0.0.1:80")
+	if _, err := c.Set_add(o); err != nil {
+		t.Fatal(err)
+	}
+
+	fwds := []govs.Fwd{govs.FWD_DR, govs.FWD_TUNNEL, govs.FWD_NAT, govs.FWD_FULLNAT}
+	for i, fwd := range fwds {
+		d := *o
+		d.Daddr = inet_addr(t, fmt.Sprintf("192.168.1.%d:8080", i+2))
+		d.Fwd = fwd
+		d.Weight = 10
+		if _, err := c.Set_adddest(&d); err != nil {
+			t.Fatal(err)
+		}
+
+		d.Fwd = govs.FWD_UNSET
+		d.Weight = 5
+		if _, err := c.Set_editdest(&d); err != nil {
+			t.Fatal(err)
+		}
+		tx := c.Begin()
+		d.Weight = 3
+		if err := tx.Edit_dest(context.Background(), &d); err != nil {
+			t.Fatal(err)
+		}
+		if err := tx.Commit(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	dests, err := c.Get_dests(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, d := range dests.Dests {
+		if d.Fwd() != fwds[i].String() || d.Weight != 3 {
+			t.Errorf("dest %s %s weight %d, want %s weight 3",
+				d.Address(), d.Fwd(), d.Weight, fwds[i])
+		}
+	}
+
+	d := *o
+	d.Daddr = dests.Dests[0].Address()
+	d.Fwd = govs.FWD_TUNNEL
+	if _, err := c.Set_editdest(&d); err != nil {
+		t.Fatal(err)
+	}
+	dests, err = c.Get_dests(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fwd := dests.Dests[0].Fwd(); fwd != "tunnel" {
+		t.Errorf("dest %s, want tunnel", fwd)
+	}
+}
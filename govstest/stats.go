@@ -0,0 +1,212 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govstest
+
+import "github.com/yubo/govs"
+
+// the fake data plane: one io core, two workers and two ports
+var (
+	io_cores     = []int{1}
+	worker_cores = []int{2, 3}
+	ports        = []int{0, 1}
+)
+
+// synthetic counters, stable for a given object
+func counter(id, n int) int64 {
+	return int64((id+1)*1000 + n)
+}
+
+func selected(ids []int, id int) []int {
+	if id < 0 {
+		return ids
+	}
+	for _, i := range ids {
+		if i == id {
+			return []int{id}
+		}
+	}
+	return nil
+}
+
+func (m *model) stats(q *govs.Vs_stats_q) interface{} {
+	switch q.Type {
+	case govs.VS_STATS_IO:
+		return m.stats_io(q.Id)
+	case govs.VS_STATS_WORKER:
+		return m.stats_worker(q.Id)
+	case govs.VS_ESTATS_WORKER:
+		return m.estats_worker(q.Id)
+	case govs.VS_STATS_DEV:
+		return m.stats_dev(q.Id)
+	case govs.VS_STATS_CTL:
+		return m.stats_ctl()
+	case govs.VS_STATS_MEM:
+		return m.stats_mem()
+	}
+	return cmd_r(govs.EINVAL, "unsupported stats type")
+}
+
+func (m *model) stats_io(id int) interface{} {
+	ids := selected(io_cores, id)
+	if ids == nil {
+		return govs.Vs_stats_io_r{Code: -govs.ENOENT, Msg: "no such core"}
+	}
+
+	r := govs.Vs_stats_io_r{}
+	for _, core := range ids {
+		e := govs.Vs_stats_io_entry{Core_id: core}
+		for q, port := range ports {
+			e.Rx_nic_queues_port = append(e.Rx_nic_queues_port, int32(port))
+			e.Rx_nic_queues_queue = append(e.Rx_nic_queues_queue, int32(q))
+			e.Rx_nic_queues_iters = append(e.Rx_nic_queues_iters, counter(core, 1))
+			e.Rx_nic_queues_pkts = append(e.Rx_nic_queues_pkts, counter(core, 2))
+
+			e.Tx_nic_ports_port = append(e.Tx_nic_ports_port, int32(port))
+			e.Tx_nic_ports_queue = append(e.Tx_nic_ports_queue, int32(q))
+			e.Tx_nic_ports_iters = append(e.Tx_nic_ports_iters, counter(core, 3))
+			e.Tx_nic_ports_pkts = append(e.Tx_nic_ports_pkts, counter(core, 4))
+			e.Tx_nic_ports_drop_iters = append(e.Tx_nic_ports_drop_iters, 1)
+			e.Tx_nic_ports_drop_pkts = append(e.Tx_nic_ports_drop_pkts, 1)
+
+			e.Kni = append(e.Kni, govs.Vs_stats_ifa{
+				Port_id:    port,
+				Rx_packets: counter(port, 5),
+				Tx_packets: counter(port, 6),
+			})
+		}
+		for range worker_cores {
+			e.Rx_rings_iters = append(e.Rx_rings_iters, counter(core, 7))
+			e.Rx_rings_pkts = append(e.Rx_rings_pkts, counter(core, 8))
+			e.Rx_rings_drop_iters = append(e.Rx_rings_drop_iters, 1)
+			e.Rx_rings_drop_pkts = append(e.Rx_rings_drop_pkts, 1)
+			e.Rx_rings_drop_count = append(e.Rx_rings_drop_count, 1)
+		}
+		r.Io = append(r.Io, e)
+	}
+	return r
+}
+
+func (m *model) stats_worker(id int) interface{} {
+	ids := selected(worker_cores, id)
+	if ids == nil {
+		return govs.Vs_stats_worker_r{Code: -govs.ENOENT, Msg: "no such core"}
+	}
+
+	r := govs.Vs_stats_worker_r{}
+	for _, core := range ids {
+		e := govs.Vs_stats_worker_entry{
+			Core_id:  core,
+			Conns:    counter(core, 0),
+			Inpkts:   counter(core, 1),
+			Outpkts:  counter(core, 2),
+			Inbytes:  counter(core, 3) * 64,
+			Outbytes: counter(core, 4) * 64,
+		}
+		for range io_cores {
+			e.Rings_in_iters = append(e.Rings_in_iters, counter(core, 5))
+			e.Rings_in_pkts = append(e.Rings_in_pkts, counter(core, 6))
+			e.Rings_in_miss = append(e.Rings_in_miss, 1)
+			e.Rings_in_miss_count = append(e.Rings_in_miss_count, 1)
+		}
+		for _, port := range ports {
+			e.Rings_out_port = append(e.Rings_out_port, int32(port))
+			e.Rings_out_iters = append(e.Rings_out_iters, counter(core, 7))
+			e.Rings_out_pkts = append(e.Rings_out_pkts, counter(core, 8))
+			e.Rings_out_drop_iters = append(e.Rings_out_drop_iters, 0)
+			e.Rings_out_drop_pkts = append(e.Rings_out_drop_pkts, 0)
+		}
+		r.Worker = append(r.Worker, e)
+	}
+	return r
+}
+
+func (m *model) estats_worker(id int) interface{} {
+	ids := selected(worker_cores, id)
+	if ids == nil {
+		return govs.Vs_estats_worker_r{Code: -govs.ENOENT, Msg: "no such core"}
+	}
+
+	r := govs.Vs_estats_worker_r{}
+	for _, core := range ids {
+		r.Worker = append(r.Worker, map[string]int64{
+			"core_id":            int64(core),
+			"fullnat_add_toa_ok": counter(core, 1),
+			"synproxy_syn_cnt":   counter(core, 2),
+			"fast_xmit_pass":     counter(core, 3),
+		})
+	}
+	return r
+}
+
+func (m *model) stats_dev(id int) interface{} {
+	ids := selected(ports, id)
+	if ids == nil {
+		return govs.Vs_stats_dev_r{Code: -govs.ENOENT, Msg: "no such port"}
+	}
+
+	r := govs.Vs_stats_dev_r{}
+	for _, port := range ids {
+		r.Dev = append(r.Dev, govs.Vs_stats_dev_entry{
+			Port_id:  port,
+			Ipackets: counter(port, 1),
+			Opackets: counter(port, 2),
+			Ibytes:   counter(port, 1) * 64,
+			Obytes:   counter(port, 2) * 64,
+		})
+	}
+	return r
+}
+
+func (m *model) stats_ctl() interface{} {
+	r := govs.Vs_stats_ctl_r{
+		Num_services: len(m.services),
+		Seq:          m.seq,
+	}
+	r.Workers = make([]struct {
+		Worker_id    int
+		Num_services int
+		Seq          int
+		State        int
+	}, len(worker_cores))
+	for i, core := range worker_cores {
+		r.Workers[i].Worker_id = core
+		r.Workers[i].Num_services = len(m.services)
+		r.Workers[i].Seq = m.seq
+		r.Workers[i].State = govs.VS_CTL_S_SYNC
+	}
+	return r
+}
+
+func (m *model) stats_mem() interface{} {
+	r := govs.Vs_stats_mem_r{}
+	r.Size.Mbuf = 1 << 16
+	r.Size.Svc = 1 << 10
+	r.Size.Rs = 1 << 14
+	r.Size.Laddr = 1 << 12
+	r.Size.Conn = CONN_TABLE
+
+	r.Available = make([]struct {
+		Socket_id int
+		Mbuf      int
+		Svc       int
+		Rs        int
+		Laddr     int
+		Conn      int
+	}, 1)
+	a := &r.Available[0]
+	a.Mbuf = r.Size.Mbuf
+	a.Svc = r.Size.Svc - len(m.services)
+	a.Rs = r.Size.Rs
+	a.Laddr = r.Size.Laddr
+	a.Conn = r.Size.Conn
+	for _, svc := range m.services {
+		a.Rs -= len(svc.dests)
+		a.Laddr -= len(svc.laddrs)
+	}
+	return r
+}
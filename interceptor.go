@@ -0,0 +1,183 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Invoker sends a request, method is "api" or "stats", args is the
+// request struct (Vs_service_q, Vs_dest_q, Vs_stats_q ...) and
+// reply points to the reply struct.
+type Invoker func(ctx context.Context, method string, args interface{}, reply interface{}) error
+
+// Interceptor is called around every request of a client, it calls
+// invoker to go on with the request, including the redials and
+// retries of the client.
+type Interceptor func(ctx context.Context, method string, args interface{},
+	reply interface{}, invoker Invoker) error
+
+func (i Interceptor) wrap(invoker Invoker) Invoker {
+	return func(ctx context.Context, method string, args interface{}, reply interface{}) error {
+		return i(ctx, method, args, reply, invoker)
+	}
+}
+
+// Use appends interceptors to the chain of c, the first one added
+// is the outermost.
+func (c *Client) Use(interceptors ...Interceptor) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	chain := make([]Interceptor, 0, len(c.interceptors)+len(interceptors))
+	chain = append(chain, c.interceptors...)
+	c.interceptors = append(chain, interceptors...)
+}
+
+// Log_interceptor logs every request with its latency, failed ones
+// at warn level, and the reply of the others at debug level.
+func Log_interceptor(l *slog.Logger) Interceptor {
+	return func(ctx context.Context, method string, args interface{},
+		reply interface{}, invoker Invoker) error {
+		start := time.Now()
+		err := invoker(ctx, method, args, reply)
+
+		op := op_name(method, op_cmd(method, args))
+		attrs := []slog.Attr{
+			slog.String("method", method),
+			slog.String("op", op),
+			slog.String("args", fmt.Sprintf("%+v", args)),
+			slog.Duration("latency", time.Since(start)),
+		}
+		if err != nil {
+			attrs = append(attrs, slog.String("err", err.Error()))
+			l.LogAttrs(ctx, slog.LevelWarn, "dpvs call", attrs...)
+		} else {
+			l.LogAttrs(ctx, slog.LevelInfo, "dpvs call", attrs...)
+			l.LogAttrs(ctx, slog.LevelDebug, "dpvs reply",
+				slog.String("op", op),
+				slog.String("reply", fmt.Sprintf("%+v", reply)))
+		}
+		return err
+	}
+}
+
+var DefaultLatencyBuckets = []time.Duration{
+	100 * time.Microsecond,
+	500 * time.Microsecond,
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+}
+
+// Latency_histogram counts request latencies per operation, e.g.
+// "new dest" or "stats io".
+type Latency_histogram struct {
+	// upper bounds, the last bucket counts everything above
+	Buckets []time.Duration
+
+	mu  sync.Mutex
+	ops map[string]*Latency_op
+}
+
+type Latency_op struct {
+	Counts []uint64 /* len(Buckets) + 1 */
+	Count  uint64
+	Errors uint64
+	Sum    time.Duration
+}
+
+// New_latency_histogram returns a histogram with buckets, or
+// DefaultLatencyBuckets if none given.
+func New_latency_histogram(buckets ...time.Duration) *Latency_histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultLatencyBuckets
+	}
+	b := append([]time.Duration{}, buckets...)
+	sort.Slice(b, func(i, j int) bool { return b[i] < b[j] })
+	return &Latency_histogram{Buckets: b, ops: make(map[string]*Latency_op)}
+}
+
+func (h *Latency_histogram) Observe(op string, d time.Duration, err error) {
+	i := sort.Search(len(h.Buckets), func(i int) bool { return d <= h.Buckets[i] })
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	o, ok := h.ops[op]
+	if !ok {
+		o = &Latency_op{Counts: make([]uint64, len(h.Buckets)+1)}
+		h.ops[op] = o
+	}
+	o.Counts[i]++
+	o.Count++
+	o.Sum += d
+	if err != nil {
+		o.Errors++
+	}
+}
+
+// Snapshot returns a copy of the counters by operation.
+func (h *Latency_histogram) Snapshot() map[string]Latency_op {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ret := make(map[string]Latency_op, len(h.ops))
+	for name, o := range h.ops {
+		c := *o
+		c.Counts = append([]uint64{}, o.Counts...)
+		ret[name] = c
+	}
+	return ret
+}
+
+func (h *Latency_histogram) Interceptor() Interceptor {
+	return func(ctx context.Context, method string, args interface{},
+		reply interface{}, invoker Invoker) error {
+		start := time.Now()
+		err := invoker(ctx, method, args, reply)
+		h.Observe(op_name(method, op_cmd(method, args)), time.Since(start), err)
+		return err
+	}
+}
+
+func (h *Latency_histogram) String() string {
+	ops := h.Snapshot()
+	names := make([]string, 0, len(ops))
+	for name := range ops {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-16s %8s %8s %10s", "op", "count", "errors", "avg")
+	for _, d := range h.Buckets {
+		fmt.Fprintf(&b, " %8s", "<="+d.String())
+	}
+	fmt.Fprintf(&b, " %8s\n", ">")
+
+	for _, name := range names {
+		o := ops[name]
+		fmt.Fprintf(&b, "%-16s %8d %8d %10s", name, o.Count, o.Errors,
+			(o.Sum / time.Duration(o.Count)).String())
+		for _, n := range o.Counts {
+			fmt.Fprintf(&b, " %8d", n)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,54 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs_test
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/yubo/govs"
+	"github.com/yubo/govs/govstest"
+)
+
+func TestLog_interceptor(t *testing.T) {
+	for _, level := range []slog.Level{slog.LevelInfo, slog.LevelDebug} {
+		var buf bytes.Buffer
+		c := govstest.NewClient(t)
+		c.Use(govs.Log_interceptor(slog.New(slog.NewTextHandler(&buf,
+			&slog.HandlerOptions{Level: level}))))
+
+		if _, err := c.Get_version(); err != nil {
+			t.Fatal(err)
+		}
+		_, err := c.Get_service(options(t, "10.0.0.1:80", "", 0))
+		if !errors.Is(err, govs.ErrNotExist) {
+			t.Fatalf("err %v, want ErrNotExist", err)
+		}
+
+		lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+		want := []string{
+			"level=INFO msg=\"dpvs call\" method=api op=\"get info\"",
+			"level=DEBUG msg=\"dpvs reply\" op=\"get info\" reply=\"version\\t\\t1.2.0",
+			"level=WARN msg=\"dpvs call\" method=api op=\"get service\"",
+		}
+		if level == slog.LevelInfo {
+			want = []string{want[0], want[2]}
+		}
+		if len(lines) != len(want) {
+			t.Fatalf("level %s: got\n%s", level, buf.String())
+		}
+		for i, w := range want {
+			if !strings.Contains(lines[i], w) {
+				t.Errorf("level %s: line %d\n%s\nwant %s", level, i, lines[i], w)
+			}
+		}
+	}
+}
@@ -0,0 +1,358 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/*
+ * Load_keepalived reads the virtual_server blocks of a keepalived.conf
+ * into a Config, and the local_address_group blocks of the alibaba
+ * fork into the laddrs of the services naming them:
+ *
+ *   virtual_server 10.0.0.1 80 {
+ *       lb_algo wrr
+ *       lb_kind FNAT
+ *       persistence_timeout 300
+ *       protocol TCP
+ *       laddr_group_name laddr_g1
+ *       real_server 192.168.1.2 8080 {
+ *           weight 10
+ *       }
+ *   }
+ *   local_address_group laddr_g1 {
+ *       192.168.1.100-101
+ *   }
+ *
+ * The directives govs has no use for, vrrp, health checks and the
+ * like, are skipped and returned as unsupported, one per line.
+ */
+func Load_keepalived(file string) (cfg *Config, unsupported []string, err error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, nil, err
+	}
+	cfg, unsupported, err = Parse_keepalived(data)
+	if err != nil {
+		return nil, unsupported, fmt.Errorf("%s: %w", file, err)
+	}
+	return cfg, unsupported, nil
+}
+
+type kv_node struct {
+	line     int
+	name     string
+	args     []string
+	children []*kv_node
+}
+
+type kv_token struct {
+	line int
+	text string /* "" ends a line */
+}
+
+func kv_tokens(data []byte) []kv_token {
+	var toks []kv_token
+	for i, line := range strings.Split(string(data), "\n") {
+		if j := strings.IndexAny(line, "#!"); j >= 0 {
+			line = line[:j]
+		}
+		line = strings.NewReplacer("{", " { ", "}", " } ").Replace(line)
+		for _, f := range strings.Fields(line) {
+			toks = append(toks, kv_token{i + 1, f})
+		}
+		toks = append(toks, kv_token{i + 1, ""})
+	}
+	return toks
+}
+
+// kv_block reads the directives up to the '}' closing a block
+func kv_block(toks []kv_token, i int, top bool) ([]*kv_node, int, error) {
+	var nodes []*kv_node
+
+	for i < len(toks) {
+		switch toks[i].text {
+		case "":
+			i++
+			continue
+		case "}":
+			if top {
+				return nil, 0, fmt.Errorf("line %d: unexpected '}'", toks[i].line)
+			}
+			return nodes, i + 1, nil
+		case "{":
+			return nil, 0, fmt.Errorf("line %d: unexpected '{'", toks[i].line)
+		}
+
+		n := &kv_node{line: toks[i].line, name: toks[i].text}
+		for i++; i < len(toks) && toks[i].text != "" &&
+			toks[i].text != "{" && toks[i].text != "}"; i++ {
+			n.args = append(n.args, toks[i].text)
+		}
+		nodes = append(nodes, n)
+
+		/* the '{' of a block may be on the next line */
+		j := i
+		for j < len(toks) && toks[j].text == "" {
+			j++
+		}
+		if j < len(toks) && toks[j].text == "{" {
+			var err error
+			if n.children, i, err = kv_block(toks, j+1, false); err != nil {
+				return nil, 0, err
+			}
+			if n.children == nil {
+				n.children = []*kv_node{}
+			}
+		}
+	}
+	if !top {
+		return nil, 0, fmt.Errorf("line %d: missing '}'", toks[len(toks)-1].line)
+	}
+	return nodes, i, nil
+}
+
+var keepalived_fwds = map[string]Fwd{
+	"NAT":     FWD_NAT,
+	"DR":      FWD_DR,
+	"TUN":     FWD_TUNNEL,
+	"FNAT":    FWD_FULLNAT,
+	"FULLNAT": FWD_FULLNAT,
+}
+
+// kv_addr joins the "ip port" of a keepalived directive
+func kv_addr(n *kv_node, port string) (a Inet_addr, err error) {
+	if len(n.args) < 1 || len(n.args) > 2 {
+		return a, fmt.Errorf("line %d: %s: expect ip port", n.line, n.name)
+	}
+	if len(n.args) == 2 {
+		port = n.args[1]
+	}
+	host := n.args[0]
+	if strings.Contains(host, ":") {
+		host = "[" + host + "]"
+	}
+	if port != "" {
+		host += ":" + port
+	}
+	if err := a.Set(host); err != nil {
+		return a, fmt.Errorf("line %d: %s %s: %w", n.line, n.name, strings.Join(n.args, " "), err)
+	}
+	return a, nil
+}
+
+func kv_uint(n *kv_node) (uint, error) {
+	if len(n.args) == 1 {
+		if u, err := strconv.ParseUint(n.args[0], 10, 32); err == nil {
+			return uint(u), nil
+		}
+	}
+	return 0, fmt.Errorf("expect a number")
+}
+
+func kv_arg(n *kv_node) (string, error) {
+	if len(n.args) != 1 {
+		return "", fmt.Errorf("expect one argument")
+	}
+	return n.args[0], nil
+}
+
+// kv_range expands 192.168.1.100-105 of a local_address_group
+func kv_range(n *kv_node) ([]Inet_addr, error) {
+	bad := fmt.Errorf("line %d: %s: expect an ip or an ipv4 range 192.168.1.100-105", n.line, n.name)
+	if len(n.args) != 0 {
+		return nil, bad
+	}
+
+	first, last := n.name, ""
+	if i := strings.LastIndex(n.name, "-"); i > 0 {
+		first, last = n.name[:i], n.name[i+1:]
+	}
+
+	var a Inet_addr
+	if err := a.Set(first); err != nil || a.Port != 0 {
+		return nil, bad
+	}
+	if last == "" {
+		return []Inet_addr{a}, nil
+	}
+
+	ip := net.ParseIP(first).To4()
+	end, err := strconv.ParseUint(last, 10, 8)
+	if ip == nil || err != nil || uint64(ip[3]) > end {
+		return nil, bad
+	}
+	var addrs []Inet_addr
+	for b := uint64(ip[3]); b <= end; b++ {
+		ip[3] = byte(b)
+		a.Set(ip.String())
+		addrs = append(addrs, a)
+	}
+	return addrs, nil
+}
+
+// Parse_keepalived reads a keepalived.conf, see Load_keepalived
+func Parse_keepalived(data []byte) (cfg *Config, unsupported []string, err error) {
+	nodes, _, err := kv_block(kv_tokens(data), 0, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	skip := func(n *kv_node) {
+		unsupported = append(unsupported, fmt.Sprintf("line %d: %s",
+			n.line, strings.Join(append([]string{n.name}, n.args...), " ")))
+	}
+
+	cfg = &Config{Services: []Service_config{}}
+	groups := make(map[string][]Inet_addr)
+	group_names := make(map[int]*kv_node) /* service index -> laddr_group_name */
+
+	for _, n := range nodes {
+		switch n.name {
+		case "virtual_server":
+			if len(n.args) > 0 && (n.args[0] == "fwmark" || n.args[0] == "group") {
+				skip(n)
+				continue
+			}
+			s, group, err := kv_service(n, skip)
+			if err != nil {
+				return nil, unsupported, err
+			}
+			if group != nil {
+				group_names[len(cfg.Services)] = group
+			}
+			cfg.Services = append(cfg.Services, *s)
+
+		case "local_address_group":
+			name, err := kv_arg(n)
+			if err != nil {
+				return nil, unsupported, fmt.Errorf("line %d: %s: %w", n.line, n.name, err)
+			}
+			groups[name] = []Inet_addr{}
+			for _, c := range n.children {
+				addrs, err := kv_range(c)
+				if err != nil {
+					return nil, unsupported, err
+				}
+				groups[name] = append(groups[name], addrs...)
+			}
+
+		default:
+			skip(n)
+		}
+	}
+
+	for i, g := range group_names {
+		laddrs, ok := groups[g.args[0]]
+		if !ok {
+			return nil, unsupported, fmt.Errorf("line %d: no local_address_group %s", g.line, g.args[0])
+		}
+		cfg.Services[i].Laddrs = laddrs
+	}
+	return cfg, unsupported, cfg.Check()
+}
+
+// kv_service reads a virtual_server, group is its laddr_group_name
+func kv_service(n *kv_node, skip func(*kv_node)) (s *Service_config, group *kv_node, err error) {
+	s = &Service_config{Protocol: IPPROTO_TCP}
+	if s.Addr, err = kv_addr(n, ""); err != nil {
+		return nil, nil, err
+	}
+
+	fwd := FWD_NAT /* keepalived's default */
+	var sched_opts []string
+	var dests []*kv_node
+
+	for _, c := range n.children {
+		var arg string
+		switch c.name {
+		case "lb_algo":
+			if arg, err = kv_arg(c); err == nil {
+				var sched *Sched
+				if sched, err = Find_sched(arg); err == nil {
+					s.Sched = sched.Name
+				}
+			}
+		case "lb_kind":
+			if arg, err = kv_arg(c); err == nil {
+				var ok bool
+				if fwd, ok = keepalived_fwds[strings.ToUpper(arg)]; !ok {
+					err = fmt.Errorf("%s: expect NAT, DR, TUN or FNAT", arg)
+				}
+			}
+		case "protocol":
+			if arg, err = kv_arg(c); err == nil {
+				err = s.Protocol.Set(strings.ToLower(arg))
+			}
+		case "persistence_timeout":
+			s.Flags |= VS_SVC_F_PERSISTENT
+			s.Timeout, err = kv_uint(c)
+		case "persistence_granularity":
+			if arg, err = kv_arg(c); err == nil {
+				err = s.Netmask.Set(arg)
+			}
+		case "ops":
+			s.Flags |= VS_SVC_F_ONEPACKET
+		case "syn_proxy":
+			s.Flags |= VS_SVC_F_SYNPROXY
+		case "sh-port", "sh-fallback", "mh-port", "mh-fallback":
+			sched_opts = append(sched_opts, c.name)
+		case "laddr_group_name":
+			_, err = kv_arg(c)
+			group = c
+		case "real_server":
+			dests = append(dests, c)
+		default:
+			skip(c)
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("line %d: %s: %w", c.line, c.name, err)
+		}
+	}
+
+	if len(sched_opts) > 0 {
+		if err := s.Sched_opts.Set(strings.Join(sched_opts, ",")); err != nil {
+			return nil, nil, fmt.Errorf("line %d: %s: %w", n.line, n.name, err)
+		}
+	}
+
+	for _, c := range dests {
+		d := Dest_config{Weight: 1, Fwd: fwd}
+		port := ""
+		if s.Addr.Port != 0 {
+			port = s.Addr.Port.String()
+		}
+		if d.Addr, err = kv_addr(c, port); err != nil {
+			return nil, nil, err
+		}
+		for _, rc := range c.children {
+			var u uint
+			switch rc.name {
+			case "weight":
+				u, err = kv_uint(rc)
+				d.Weight = int(u)
+			case "uthreshold":
+				d.U_threshold, err = kv_uint(rc)
+			case "lthreshold":
+				d.L_threshold, err = kv_uint(rc)
+			default:
+				skip(rc)
+			}
+			if err != nil {
+				return nil, nil, fmt.Errorf("line %d: %s: %w", rc.line, rc.name, err)
+			}
+		}
+		s.Dests = append(s.Dests, d)
+	}
+	return s, group, nil
+}
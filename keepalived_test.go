@@ -0,0 +1,129 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const keepalived_conf = `! Configuration File for keepalived
+global_defs {
+    router_id LVS_1
+}
+
+vrrp_instance VI_1 {
+    state MASTER
+    virtual_ipaddress {
+        10.0.0.1
+    }
+}
+
+local_address_group laddr_g1 {
+    192.168.1.100-101
+    2001:db8::100
+}
+
+virtual_server 10.0.0.1 80 {
+    delay_loop 6
+    lb_algo wrr
+    lb_kind FNAT
+    persistence_timeout 300
+    protocol TCP
+    syn_proxy
+    laddr_group_name laddr_g1
+
+    real_server 192.168.1.2 8080 {
+        weight 10
+        uthreshold 1000
+        TCP_CHECK {
+            connect_timeout 3
+        }
+    }
+    real_server 192.168.1.3 {
+        weight 0
+    }
+}
+
+virtual_server 2001:db8::1 443
+{
+    lb_algo mh
+    mh-fallback
+    lb_kind DR
+    protocol UDP
+    real_server 2001:db8::2 8443 {
+    }
+}
+
+virtual_server fwmark 1 {
+    lb_algo rr
+}
+`
+
+func TestParse_keepalived(t *testing.T) {
+	cfg, unsupported, err := Parse_keepalived([]byte(keepalived_conf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	laddrs := []Inet_addr{must_addr(t, "192.168.1.100"),
+		must_addr(t, "192.168.1.101"), must_addr(t, "2001:db8::100")}
+	want := []Service_config{{
+		Addr: must_addr(t, "10.0.0.1:80"), Protocol: IPPROTO_TCP, Sched: "wrr",
+		Flags: VS_SVC_F_PERSISTENT | VS_SVC_F_SYNPROXY, Timeout: 300,
+		Dests: []Dest_config{
+			{Addr: must_addr(t, "192.168.1.2:8080"), Weight: 10, Fwd: FWD_FULLNAT, U_threshold: 1000},
+			/* the port of the service */
+			{Addr: must_addr(t, "192.168.1.3:80"), Weight: 0, Fwd: FWD_FULLNAT},
+		},
+		Laddrs: laddrs,
+	}, {
+		Addr: must_addr(t, "[2001:db8::1]:443"), Protocol: IPPROTO_UDP, Sched: "mh",
+		Sched_opts: Sched_opts{Sched: "mh", Flags: VS_SCHED_F_FALLBACK},
+		/* weight 1 is keepalived's default */
+		Dests: []Dest_config{{Addr: must_addr(t, "[2001:db8::2]:8443"), Weight: 1, Fwd: FWD_DR}},
+	}}
+	if !reflect.DeepEqual(cfg.Services, want) {
+		t.Errorf("got  %+v\nwant %+v", cfg.Services, want)
+	}
+
+	want_unsupported := []string{
+		"line 2: global_defs",
+		"line 6: vrrp_instance VI_1",
+		"line 19: delay_loop 6",
+		"line 30: TCP_CHECK",
+		"line 49: virtual_server fwmark 1",
+	}
+	if !reflect.DeepEqual(unsupported, want_unsupported) {
+		t.Errorf("unsupported\ngot  %q\nwant %q", unsupported, want_unsupported)
+	}
+}
+
+func TestParse_keepalived_error(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		in   string
+		err  string
+	}{
+		{"missing brace", "virtual_server 10.0.0.1 80 {\n lb_algo rr\n", "line 3: missing '}'"},
+		{"extra brace", "global_defs {\n}\n}\n", "line 3: unexpected '}'"},
+		{"bad lb_kind", "virtual_server 10.0.0.1 80 {\n lb_kind LOCAL\n}", "line 2: lb_kind: LOCAL: expect NAT, DR, TUN or FNAT"},
+		{"bad lb_algo", "virtual_server 10.0.0.1 80 {\n lb_algo fastest\n}", "line 2: lb_algo"},
+		{"bad weight", "virtual_server 10.0.0.1 80 {\n real_server 192.168.1.2 80 {\n weight heavy\n }\n}", "line 3: weight: expect a number"},
+		{"bad address", "virtual_server 10.0.0.300 80 {\n}", "line 1: virtual_server 10.0.0.300 80"},
+		{"unknown laddr group", "virtual_server 10.0.0.1 80 {\n laddr_group_name g1\n}", "line 2: no local_address_group g1"},
+		{"bad laddr range", "local_address_group g1 {\n 192.168.1.100-99\n}", "line 2: 192.168.1.100-99"},
+		{"sched option of another sched", "virtual_server 10.0.0.1 80 {\n lb_algo wrr\n sh-port\n}", "sh options for scheduler wrr"},
+	} {
+		_, _, err := Parse_keepalived([]byte(c.in))
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: err %v, want %q", c.name, err, c.err)
+		}
+	}
+}
@@ -8,32 +8,57 @@
 package govs
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 )
 
 type Vs_laddr_user struct {
-	Nic  uint8
-	Addr Be32
+	Nic   uint8
+	Af    uint16
+	Addr  Be32
+	Addr6 In6_addr
+}
+
+// MarshalJSON leaves Af and Addr6 out of an ipv4 laddr, the wire
+// format of dpvs without ipv6 support
+func (u Vs_laddr_user) MarshalJSON() ([]byte, error) {
+	type user Vs_laddr_user
+	if u.Af == AF_INET6 {
+		return json.Marshal(user(u))
+	}
+	return json.Marshal(struct {
+		user
+		Af    *uint16   `json:",omitempty"`
+		Addr6 *In6_addr `json:",omitempty"`
+	}{user: user(u)})
 }
 
 type Vs_laddr_user_r struct {
+	Af            uint16
 	Addr          Be32
+	Addr6         In6_addr
 	Conn_counts   uint32
 	Port_conflict uint64
 }
 
 func Laddr_title() string {
-	return fmt.Sprintf("    %15s %8s %8s",
+	return fmt.Sprintf("    %39s %8s %8s",
 		"Addr", "Conn_counts", "Port_conflict")
 }
 
 func (l Vs_laddr_user_r) String() string {
-	return fmt.Sprintf("    %15s %8d %8d",
-		l.Addr.String(),
+	return fmt.Sprintf("    %39s %8d %8d",
+		l.Address().Ip_string(),
 		l.Conn_counts, l.Port_conflict)
 }
 
+// Address returns the local address
+func (l *Vs_laddr_user_r) Address() Inet_addr {
+	return inet_addr(l.Af, l.Addr, l.Addr6, 0)
+}
+
 type Vs_list_laddrs_r struct {
 	Code   int
 	Msg    string
@@ -43,7 +68,7 @@ type Vs_list_laddrs_r struct {
 func (r Vs_list_laddrs_r) String() string {
 	var s string
 	if r.Code != 0 {
-		return fmt.Sprintf("%s:%s", Ecode(r.Code), r.Msg)
+		return errstr(r.Code, r.Msg)
 	}
 
 	for _, laddr := range r.Laddrs {
@@ -52,19 +77,19 @@ func (r Vs_list_laddrs_r) String() string {
 	return strings.TrimRight(s, "\n")
 }
 
-func Get_laddrs(o *CmdOptions) (*Vs_list_laddrs_r, error) {
+func (c *Client) Get_laddrs(o *CmdOptions) (*Vs_list_laddrs_r, error) {
+	return c.Get_laddrs_ctx(context.Background(), o)
+}
+
+func (c *Client) Get_laddrs_ctx(ctx context.Context, o *CmdOptions) (*Vs_list_laddrs_r, error) {
 	var reply Vs_list_laddrs_r
 	args := Vs_list_q{
-		Cmd: VS_CMD_GET_LADDR,
-		Service: Vs_service_user{
-			Addr:     o.Addr.Ip,
-			Port:     o.Addr.Port,
-			Protocol: uint8(o.Protocol),
-			Number:   o.Number,
-		},
+		Cmd:     VS_CMD_GET_LADDR,
+		Service: service_key(o),
 	}
+	args.Service.Number = o.Number
 
-	err := client.Call("api", args, &reply)
+	err := c.call(ctx, "api", args, &reply)
 	return &reply, err
 }
 
@@ -74,40 +99,63 @@ type Vs_laddr_q struct {
 	Laddr   Vs_laddr_user
 }
 
-func Set_addladdr(o *CmdOptions) (*Vs_cmd_r, error) {
-	var reply Vs_cmd_r
-	args := Vs_laddr_q{
-		Cmd: VS_CMD_NEW_LADDR,
-		Service: Vs_service_user{
-			Protocol: uint8(o.Protocol),
-			Addr:     o.Addr.Ip,
-			Port:     o.Addr.Port,
-		},
+func laddr_q(cmd int, o *CmdOptions) Vs_laddr_q {
+	return Vs_laddr_q{
+		Cmd:     cmd,
+		Service: service_key(o),
 		Laddr: Vs_laddr_user{
-			Nic:  uint8(o.Lnic),
-			Addr: o.Lip,
+			Nic:   uint8(o.Lnic),
+			Af:    o.Lip.af(),
+			Addr:  o.Lip.Ip,
+			Addr6: o.Lip.Ip6,
 		},
 	}
+}
+
+func (c *Client) Set_addladdr(o *CmdOptions) (*Vs_cmd_r, error) {
+	return c.Set_addladdr_ctx(context.Background(), o)
+}
 
-	err := client.Call("api", args, &reply)
+func (c *Client) Set_addladdr_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
+	var reply Vs_cmd_r
+	args := laddr_q(VS_CMD_NEW_LADDR, o)
+
+	err := c.call(ctx, "api", args, &reply)
 	return &reply, err
 }
 
-func Set_delladdr(o *CmdOptions) (*Vs_cmd_r, error) {
+func (c *Client) Set_delladdr(o *CmdOptions) (*Vs_cmd_r, error) {
+	return c.Set_delladdr_ctx(context.Background(), o)
+}
+
+func (c *Client) Set_delladdr_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
 	var reply Vs_cmd_r
-	args := Vs_laddr_q{
-		Cmd: VS_CMD_DEL_LADDR,
-		Service: Vs_service_user{
-			Protocol: uint8(o.Protocol),
-			Addr:     o.Addr.Ip,
-			Port:     o.Addr.Port,
-		},
-		Laddr: Vs_laddr_user{
-			Nic:  uint8(o.Lnic),
-			Addr: o.Lip,
-		},
-	}
+	args := laddr_q(VS_CMD_DEL_LADDR, o)
 
-	err := client.Call("api", args, &reply)
+	err := c.call(ctx, "api", args, &reply)
 	return &reply, err
 }
+
+func Get_laddrs(o *CmdOptions) (*Vs_list_laddrs_r, error) {
+	return DefaultClient.Get_laddrs(o)
+}
+
+func Get_laddrs_ctx(ctx context.Context, o *CmdOptions) (*Vs_list_laddrs_r, error) {
+	return DefaultClient.Get_laddrs_ctx(ctx, o)
+}
+
+func Set_addladdr(o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_addladdr(o)
+}
+
+func Set_addladdr_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_addladdr_ctx(ctx, o)
+}
+
+func Set_delladdr(o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_delladdr(o)
+}
+
+func Set_delladdr_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_delladdr_ctx(ctx, o)
+}
@@ -0,0 +1,441 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Change is a field of a service or dest a Plan sets, From is empty
+// for the fields of an add
+type Change struct {
+	Field string `json:"field"`
+	From  string `json:"from,omitempty"`
+	To    string `json:"to"`
+}
+
+func (c Change) String() string {
+	if c.From == "" {
+		return fmt.Sprintf("%s %s", c.Field, c.To)
+	}
+	return fmt.Sprintf("%s %s -> %s", c.Field, c.From, c.To)
+}
+
+// Op is one command of a Plan
+type Op struct {
+	Cmd  int
+	O    CmdOptions
+	Diff []Change
+}
+
+// Action is add, edit or del
+func (op *Op) Action() string {
+	switch op.Cmd {
+	case VS_CMD_NEW_SERVICE, VS_CMD_NEW_DEST, VS_CMD_NEW_LADDR:
+		return "add"
+	case VS_CMD_SET_SERVICE, VS_CMD_SET_DEST:
+		return "edit"
+	case VS_CMD_DEL_SERVICE, VS_CMD_DEL_DEST, VS_CMD_DEL_LADDR:
+		return "del"
+	}
+	return Cmd_name(op.Cmd)
+}
+
+// Kind is service, dest or laddr
+func (op *Op) Kind() string {
+	switch op.Cmd {
+	case VS_CMD_NEW_DEST, VS_CMD_SET_DEST, VS_CMD_DEL_DEST:
+		return "dest"
+	case VS_CMD_NEW_LADDR, VS_CMD_DEL_LADDR:
+		return "laddr"
+	}
+	return "service"
+}
+
+func (op *Op) String() string {
+	o := &op.O
+	s := fmt.Sprintf("%s %s %s", op.Action(), op.Kind(), svc_key{o.Protocol, o.Addr})
+
+	switch op.Kind() {
+	case "dest":
+		s += fmt.Sprintf(" -> %s", o.Daddr)
+	case "laddr":
+		s += " " + o.Lip.Ip_string()
+	}
+
+	if len(op.Diff) > 0 {
+		var d []string
+		for _, c := range op.Diff {
+			d = append(d, c.String())
+		}
+		s += ": " + strings.Join(d, ", ")
+	}
+	return s
+}
+
+type op_service struct {
+	Protocol Protocol  `json:"protocol"`
+	Addr     Inet_addr `json:"addr"`
+}
+
+type op_json struct {
+	Action  string     `json:"action"`
+	Kind    string     `json:"kind"`
+	Service op_service `json:"service"`
+	Dest    *Inet_addr `json:"dest,omitempty"`
+	Laddr   *Inet_addr `json:"laddr,omitempty"`
+	Changes []Change   `json:"changes,omitempty"`
+}
+
+func (op *Op) MarshalJSON() ([]byte, error) {
+	o := &op.O
+	j := op_json{
+		Action:  op.Action(),
+		Kind:    op.Kind(),
+		Service: op_service{o.Protocol, o.Addr},
+		Changes: op.Diff,
+	}
+	switch j.Kind {
+	case "dest":
+		j.Dest = &o.Daddr
+	case "laddr":
+		j.Laddr = &o.Lip
+	}
+	return json.Marshal(j)
+}
+
+/*
+ * Plan is the commands which bring dpvs to a Config, in the order
+ * they are sent: the services first, then their dests and local
+ * addresses, then, with prune, the deletes of the services left out
+ * of the Config, which take their dests and local addresses with
+ * them.
+ */
+type Plan struct {
+	Ops []*Op
+}
+
+func (p *Plan) String() string {
+	var s []string
+	for _, op := range p.Ops {
+		s = append(s, op.String())
+	}
+	return strings.Join(s, "\n")
+}
+
+// Drift tells if dpvs differs from the Config of the plan
+func (p *Plan) Drift() bool {
+	return len(p.Ops) > 0
+}
+
+// Count returns the number of adds, edits and deletes of the plan
+func (p *Plan) Count() (add, edit, del int) {
+	for _, op := range p.Ops {
+		switch op.Action() {
+		case "add":
+			add++
+		case "edit":
+			edit++
+		case "del":
+			del++
+		}
+	}
+	return
+}
+
+func (p *Plan) MarshalJSON() ([]byte, error) {
+	ops := p.Ops
+	if ops == nil {
+		ops = []*Op{}
+	}
+	return json.Marshal(struct {
+		Drift bool  `json:"drift"`
+		Ops   []*Op `json:"ops"`
+	}{p.Drift(), ops})
+}
+
+func (p *Plan) add(cmd int, o CmdOptions, diff ...Change) {
+	p.Ops = append(p.Ops, &Op{Cmd: cmd, O: o, Diff: diff})
+}
+
+// diff adds a Change if from and to print differently, with add
+// the Change is added anyway and has no From
+func diff(d *[]Change, add bool, field string, from, to interface{}) {
+	f, t := fmt.Sprint(from), fmt.Sprint(to)
+	if add {
+		*d = append(*d, Change{Field: field, To: t})
+	} else if f != t {
+		*d = append(*d, Change{Field: field, From: f, To: t})
+	}
+}
+
+// service_diff compares a live service with its config, a nil live
+// lists the fields of an add
+func service_diff(live *Vs_service_user_r, o *CmdOptions) (d []Change) {
+	add := live == nil
+	if add {
+		live = &Vs_service_user_r{}
+	}
+
+	diff(&d, add, "sched", live.Sched_name, sched_name(o.Sched_name))
+	if !add || o.Sched_opts.Flags != 0 {
+		diff(&d, add, "sched_flags",
+			Sched_opts{Sched: live.Sched_name, Flags: uint(live.Sched_flags)},
+			Sched_opts{Sched: sched_name(o.Sched_name), Flags: o.Sched_opts.Flags})
+	}
+	if o.Sched_opts.Table != 0 {
+		diff(&d, add, "sched_table", live.Sched_table, o.Sched_opts.Table)
+	}
+	if !add || o.Flags != 0 {
+		diff(&d, add, "flags", SvcFlags(live.Flags&VS_SVC_F_MASK), o.Flags)
+	}
+	if !add || o.Timeout != 0 {
+		diff(&d, add, "timeout", live.Timeout, o.Timeout)
+	}
+	if !add || o.Netmask != 0 {
+		diff(&d, add, "netmask", live.Netmask, o.Netmask)
+	}
+	return d
+}
+
+// dest_diff compares a live dest with its config, a nil live lists
+// the fields of an add
+func dest_diff(live *Vs_dest_user_r, o *CmdOptions) (d []Change) {
+	add := live == nil
+	if add {
+		live = &Vs_dest_user_r{}
+	}
+
+	want := dest_conn_flags(o)
+	have := live.Conn_flags & conn_flags_mask()
+	diff(&d, add, "weight", live.Weight, o.Weight)
+	diff(&d, add, "fwd", live.Fwd(), (&Vs_dest_user_r{Conn_flags: want}).Fwd())
+	if !add || want&^VS_CONN_F_FWD_MASK != 0 {
+		diff(&d, add, "conn_flags",
+			join_flags(have&^VS_CONN_F_FWD_MASK, conn_flag_names, nil),
+			join_flags(want&^VS_CONN_F_FWD_MASK, conn_flag_names, nil))
+	}
+	if !add || o.L_threshold != 0 || o.U_threshold != 0 {
+		diff(&d, add, "threshold",
+			fmt.Sprintf("%d-%d", live.L_threshold, live.U_threshold),
+			fmt.Sprintf("%d-%d", o.L_threshold, o.U_threshold))
+	}
+	return d
+}
+
+// Plan reads the services, dests and local addresses of dpvs and
+// returns the commands which turn them into cfg. The dests and local
+// addresses of a service of cfg which are not in cfg are deleted,
+// the services which are not in cfg only with prune. A fullnat dest
+// needs a local address of its service in cfg, see ErrNoLaddr.
+func (c *Client) Plan(ctx context.Context, cfg *Config, prune bool) (*Plan, error) {
+	if err := cfg.Check(); err != nil {
+		return nil, err
+	}
+
+	svcs, err := c.Get_services_ctx(ctx, &CmdOptions{})
+	if err != nil {
+		return nil, err
+	}
+	live := make(map[svc_key]*Vs_service_user_r)
+	for i := range svcs.Services {
+		svc := &svcs.Services[i]
+		live[svc_key{Protocol(svc.Protocol), svc.Address()}] = svc
+	}
+
+	p := &Plan{}
+	var dests, dels Plan
+
+	for i := range cfg.Services {
+		s := &cfg.Services[i]
+		o := s.options()
+		if err := s.check_laddrs(&o); err != nil {
+			return nil, err
+		}
+		svc, ok := live[s.key()]
+		delete(live, s.key())
+
+		if !ok {
+			p.add(VS_CMD_NEW_SERVICE, o, service_diff(nil, &o)...)
+			for _, l := range s.Laddrs {
+				lo := o
+				lo.Lip = l
+				dests.add(VS_CMD_NEW_LADDR, lo)
+			}
+			for j := range s.Dests {
+				do := s.Dests[j].options(&o)
+				dests.add(VS_CMD_NEW_DEST, do, dest_diff(nil, &do)...)
+			}
+			continue
+		}
+
+		if d := service_diff(svc, &o); len(d) > 0 {
+			p.add(VS_CMD_SET_SERVICE, o, d...)
+		}
+		if err := c.plan_dests(ctx, &dests, s, &o); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, svc := range svcs.Services {
+		if _, ok := live[svc_key{Protocol(svc.Protocol), svc.Address()}]; ok && prune {
+			dels.add(VS_CMD_DEL_SERVICE, CmdOptions{
+				Addr: svc.Address(), Protocol: Protocol(svc.Protocol)})
+		}
+	}
+
+	p.Ops = append(append(p.Ops, dests.Ops...), dels.Ops...)
+	return p, nil
+}
+
+// check_laddrs refuses a fullnat dest of a service without local
+// addresses, as Check_laddrs_ctx does for govs add: once applied the
+// service has the laddrs of s only
+func (s *Service_config) check_laddrs(o *CmdOptions) error {
+	if len(s.Laddrs) > 0 {
+		return nil
+	}
+	for j := range s.Dests {
+		do := s.Dests[j].options(o)
+		if fwd, _ := Conn_fwd(dest_conn_flags(&do)); fwd == FWD_FULLNAT {
+			return fmt.Errorf("%s: dest %s: %w", s.key(), do.Daddr, ErrNoLaddr)
+		}
+	}
+	return nil
+}
+
+// plan_dests plans the dests and local addresses of a live service
+func (c *Client) plan_dests(ctx context.Context, p *Plan, s *Service_config, o *CmdOptions) error {
+	dests, err := c.Get_dests_ctx(ctx, o)
+	if err != nil {
+		return err
+	}
+	live := make(map[Inet_addr]*Vs_dest_user_r)
+	for i := range dests.Dests {
+		d := &dests.Dests[i]
+		live[d.Address()] = d
+	}
+
+	for j := range s.Dests {
+		do := s.Dests[j].options(o)
+		d, ok := live[do.Daddr]
+		delete(live, do.Daddr)
+		if !ok {
+			p.add(VS_CMD_NEW_DEST, do, dest_diff(nil, &do)...)
+		} else if changes := dest_diff(d, &do); len(changes) > 0 {
+			p.add(VS_CMD_SET_DEST, do, changes...)
+		}
+	}
+	for _, d := range dests.Dests {
+		if _, ok := live[d.Address()]; ok {
+			do := *o
+			do.Daddr = d.Address()
+			p.add(VS_CMD_DEL_DEST, do)
+		}
+	}
+
+	laddrs, err := c.Get_laddrs_ctx(ctx, o)
+	if err != nil {
+		return err
+	}
+	have := make(map[Inet_addr]bool)
+	for i := range laddrs.Laddrs {
+		have[laddrs.Laddrs[i].Address()] = true
+	}
+	for _, l := range s.Laddrs {
+		if !have[l] {
+			lo := *o
+			lo.Lip = l
+			p.add(VS_CMD_NEW_LADDR, lo)
+		}
+		delete(have, l)
+	}
+	for i := range laddrs.Laddrs {
+		if l := laddrs.Laddrs[i].Address(); have[l] {
+			lo := *o
+			lo.Lip = l
+			p.add(VS_CMD_DEL_LADDR, lo)
+		}
+	}
+	return nil
+}
+
+func Plan_config(ctx context.Context, cfg *Config, prune bool) (*Plan, error) {
+	return DefaultClient.Plan(ctx, cfg, prune)
+}
+
+/*
+ * Apply sends the commands of p. With atomic, they go through a
+ * Tx and a failure rolls back the ones already applied. Without,
+ * each of the three stages of the plan runs as a Batch and a
+ * failed stage stops the ones after it.
+ */
+func (c *Client) Apply(ctx context.Context, p *Plan, atomic bool) error {
+	if atomic {
+		return c.apply_tx(ctx, p)
+	}
+
+	var stages [3]*Batch
+	for i := range stages {
+		stages[i] = c.NewBatch()
+	}
+	for _, op := range p.Ops {
+		switch op.Cmd {
+		case VS_CMD_NEW_SERVICE, VS_CMD_SET_SERVICE:
+			stages[0].Add_service(op.Cmd, &op.O)
+		case VS_CMD_NEW_DEST, VS_CMD_SET_DEST, VS_CMD_DEL_DEST:
+			stages[1].Add_dest(op.Cmd, &op.O)
+		case VS_CMD_NEW_LADDR, VS_CMD_DEL_LADDR:
+			stages[1].Add_laddr(op.Cmd, &op.O)
+		case VS_CMD_DEL_SERVICE:
+			stages[2].Add_service(op.Cmd, &op.O)
+		}
+	}
+	for _, b := range stages {
+		if err := b.Run(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Client) apply_tx(ctx context.Context, p *Plan) error {
+	tx := c.Begin()
+	for _, op := range p.Ops {
+		var err error
+		switch op.Cmd {
+		case VS_CMD_NEW_SERVICE:
+			err = tx.Add_service(ctx, &op.O)
+		case VS_CMD_SET_SERVICE:
+			err = tx.Edit_service(ctx, &op.O)
+		case VS_CMD_DEL_SERVICE:
+			err = tx.Del_service(ctx, &op.O)
+		case VS_CMD_NEW_DEST:
+			err = tx.Add_dest(ctx, &op.O)
+		case VS_CMD_SET_DEST:
+			err = tx.Edit_dest(ctx, &op.O)
+		case VS_CMD_DEL_DEST:
+			err = tx.Del_dest(ctx, &op.O)
+		case VS_CMD_NEW_LADDR:
+			err = tx.Add_laddr(ctx, &op.O)
+		case VS_CMD_DEL_LADDR:
+			err = tx.Del_laddr(ctx, &op.O)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func Apply(ctx context.Context, p *Plan, atomic bool) error {
+	return DefaultClient.Apply(ctx, p, atomic)
+}
@@ -0,0 +1,295 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/yubo/govs"
+	"github.com/yubo/govs/govstest"
+)
+
+const plan_config = `
+services:
+  - addr: 10.0.0.1:80
+    sched: wrr
+    dests:
+      - addr: 192.168.1.2:8080
+        weight: 10
+      - addr: 192.168.1.3:8080
+        weight: 5
+        fwd: dr
+    laddrs: [192.168.1.100, 192.168.1.101]
+  - addr: "[2001:db8::1]:443"
+    protocol: udp
+    dests:
+      - addr: "[2001:db8::2]:8443"
+        weight: 1
+        fwd: tunnel
+`
+
+/* drops a dest, a laddr and the udp service, edits the rest */
+const plan_config_edit = `
+services:
+  - addr: 10.0.0.1:80
+    sched: wlc
+    timeout: 300
+    flags: persistent
+    dests:
+      - addr: 192.168.1.2:8080
+        weight: 20
+      - addr: 192.168.1.4:8080
+        weight: 1
+    laddrs: [192.168.1.101]
+  - addr: 10.0.0.2:80
+`
+
+func parse_config(t *testing.T, data string) *govs.Config {
+	t.Helper()
+	cfg, err := govs.Parse_config([]byte(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cfg
+}
+
+// plan_ops renders the ops of a plan as "action kind"
+func plan_ops(p *govs.Plan) []string {
+	ops := []string{}
+	for _, op := range p.Ops {
+		ops = append(ops, op.Action()+" "+op.Kind())
+	}
+	return ops
+}
+
+// apply plans cfg, checks its ops, applies it and checks dpvs has
+// no drift left
+func apply(t *testing.T, c *govs.Client, cfg *govs.Config, atomic bool, want []string) {
+	t.Helper()
+	ctx := context.Background()
+
+	p, err := c.Plan(ctx, cfg, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !p.Drift() {
+		t.Fatal("no drift before apply")
+	}
+	if ops := plan_ops(p); !reflect.DeepEqual(ops, want) {
+		t.Fatalf("plan\n%s\ngot  %q\nwant %q", p, ops, want)
+	}
+	if err := c.Apply(ctx, p, atomic); err != nil {
+		t.Fatalf("apply\n%s\n%v", p, err)
+	}
+
+	if p, err = c.Plan(ctx, cfg, true); err != nil {
+		t.Fatal(err)
+	}
+	if p.Drift() {
+		t.Fatalf("drift after apply\n%s", p)
+	}
+}
+
+func TestPlan_apply(t *testing.T) {
+	for _, atomic := range []bool{false, true} {
+		t.Run(fmt.Sprintf("atomic=%v", atomic), func(t *testing.T) {
+			c := govstest.NewClient(t)
+			cfg := parse_config(t, plan_config)
+
+			apply(t, c, cfg, atomic, []string{
+				"add service", "add service",
+				"add laddr", "add laddr", "add dest", "add dest",
+				"add dest",
+			})
+
+			live, err := c.Get_config(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(live.Services) != 2 {
+				t.Fatalf("%d services, want 2", len(live.Services))
+			}
+
+			apply(t, c, parse_config(t, plan_config_edit), atomic, []string{
+				"edit service", "add service",
+				"edit dest", "add dest", "del dest", "del laddr",
+				"del service",
+			})
+
+			live, err = c.Get_config(context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(live.Services) != 2 {
+				t.Fatalf("%d services, want 2", len(live.Services))
+			}
+			for _, s := range live.Services {
+				if s.Addr.String() != "10.0.0.1:80" {
+					continue
+				}
+				if s.Sched != "wlc" || s.Timeout != 300 || len(s.Dests) != 2 || len(s.Laddrs) != 1 {
+					t.Errorf("service %+v", s)
+				}
+			}
+
+			/* an empty config deletes everything */
+			apply(t, c, &govs.Config{}, atomic, []string{"del service", "del service"})
+		})
+	}
+}
+
+func TestPlan_no_drift(t *testing.T) {
+	c := govstest.NewClient(t)
+	p, err := c.Plan(context.Background(), &govs.Config{}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Drift() {
+		t.Errorf("drift on an empty dpvs\n%s", p)
+	}
+}
+
+// TestPlan_partial plans a config naming one of the live services,
+// the others are deleted only with prune
+func TestPlan_partial(t *testing.T) {
+	ctx := context.Background()
+	c := govstest.NewClient(t)
+	apply(t, c, parse_config(t, plan_config), false, []string{
+		"add service", "add service",
+		"add laddr", "add laddr", "add dest", "add dest",
+		"add dest",
+	})
+
+	partial := parse_config(t, `
+services:
+  - addr: 10.0.0.1:80
+    sched: wrr
+    dests:
+      - addr: 192.168.1.2:8080
+        weight: 10
+    laddrs: [192.168.1.100, 192.168.1.101]
+`)
+	p, err := c.Plan(ctx, partial, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ops := plan_ops(p); !reflect.DeepEqual(ops, []string{"del dest"}) {
+		t.Fatalf("plan without prune\n%s", p)
+	}
+	if add, edit, del := p.Count(); add != 0 || edit != 0 || del != 1 {
+		t.Errorf("count %d %d %d, want 0 0 1", add, edit, del)
+	}
+	if err := c.Apply(ctx, p, false); err != nil {
+		t.Fatal(err)
+	}
+
+	live, err := c.Get_config(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(live.Services) != 2 {
+		t.Fatalf("%d services, want the udp one kept", len(live.Services))
+	}
+
+	p, err = c.Plan(ctx, partial, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ops := plan_ops(p); !reflect.DeepEqual(ops, []string{"del service"}) ||
+		p.Ops[0].O.Protocol != govs.IPPROTO_UDP {
+		t.Fatalf("plan with prune\n%s", p)
+	}
+}
+
+// TestApply_failure fails the second command of a plan, the atomic
+// apply rolls the first one back, the batch one keeps it
+func TestApply_failure(t *testing.T) {
+	for _, atomic := range []bool{false, true} {
+		t.Run(fmt.Sprintf("atomic=%v", atomic), func(t *testing.T) {
+			ctx := context.Background()
+			c := govstest.NewClient(t)
+			apply(t, c, parse_config(t, "services:\n  - addr: 10.0.0.2:80\n"),
+				atomic, []string{"add service"})
+
+			p, err := c.Plan(ctx, parse_config(t, `
+services:
+  - addr: 10.0.0.1:80
+  - addr: 10.0.0.2:80
+    sched: wlc
+`), false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ops := plan_ops(p); !reflect.DeepEqual(ops, []string{"add service", "edit service"}) {
+				t.Fatalf("plan\n%s", p)
+			}
+
+			/* the edit fails once its service is gone */
+			if _, err := c.Set_del_ctx(ctx, &p.Ops[1].O); err != nil {
+				t.Fatal(err)
+			}
+			err = c.Apply(ctx, p, atomic)
+			if !errors.Is(err, govs.ErrNotExist) {
+				t.Fatalf("apply err %v, want ErrNotExist", err)
+			}
+
+			_, err = c.Get_service_ctx(ctx, &p.Ops[0].O)
+			if atomic && !errors.Is(err, govs.ErrNotExist) {
+				t.Errorf("added service not rolled back, err %v", err)
+			}
+			if !atomic && err != nil {
+				t.Errorf("added service lost, err %v", err)
+			}
+		})
+	}
+}
+
+// TestPlan_no_laddr refuses a fullnat dest of a service without
+// laddrs in the config, even if dpvs has some
+func TestPlan_no_laddr(t *testing.T) {
+	ctx := context.Background()
+	c := govstest.NewClient(t)
+	apply(t, c, parse_config(t, plan_config), false, []string{
+		"add service", "add service",
+		"add laddr", "add laddr", "add dest", "add dest",
+		"add dest",
+	})
+
+	for _, cfg := range []string{`
+services:
+  - addr: 10.0.0.3:80
+    dests:
+      - addr: 192.168.1.2:8080
+`, `
+services:
+  - addr: 10.0.0.1:80
+    dests:
+      - addr: 192.168.1.2:8080
+        fwd: fullnat
+`} {
+		_, err := c.Plan(ctx, parse_config(t, cfg), false)
+		if !errors.Is(err, govs.ErrNoLaddr) {
+			t.Errorf("plan err %v, want ErrNoLaddr\n%s", err, cfg)
+		}
+	}
+
+	p, err := c.Plan(ctx, parse_config(t, `
+services:
+  - addr: 10.0.0.3:80
+    dests:
+      - addr: 192.168.1.2:8080
+        fwd: dr
+`), false)
+	if err != nil || !reflect.DeepEqual(plan_ops(p), []string{"add service", "add dest"}) {
+		t.Errorf("dr dest: %v\n%s", err, p)
+	}
+}
@@ -0,0 +1,71 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs_test
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/yubo/govs"
+	"github.com/yubo/govs/govstest"
+)
+
+func TestCheck_protocol(t *testing.T) {
+	ctx := context.Background()
+	c := govstest.NewClient(t)
+
+	calls := 0
+	c.Use(func(ctx context.Context, method string, args interface{},
+		reply interface{}, invoker govs.Invoker) error {
+		calls++
+		return invoker(ctx, method, args, reply)
+	})
+
+	add := func(proto govs.Protocol) error {
+		o := &govs.CmdOptions{Protocol: proto, Sched_name: "rr"}
+		if err := o.Addr.Set("10.0.0.1:80"); err != nil {
+			t.Fatal(err)
+		}
+		_, err := c.Set_add_ctx(ctx, o)
+		return err
+	}
+
+	/* the fake dpvs 1.2.0 balances sctp but not udplite */
+	if err := add(govs.IPPROTO_SCTP); err != nil {
+		t.Fatalf("sctp: %v", err)
+	}
+	err := add(govs.IPPROTO_UDPLITE)
+	if !errors.Is(err, govs.ErrProtoNotSupported) ||
+		!strings.Contains(err.Error(), "dpvs 1.2.0 does not balance udplite") {
+		t.Fatalf("udplite: %v", err)
+	}
+
+	calls = 0
+	if err2 := c.Check_protocol(ctx, govs.IPPROTO_UDPLITE); err2 != err {
+		t.Errorf("Check_protocol udplite: %v, want %v", err2, err)
+	}
+	if err2 := add(govs.IPPROTO_UDPLITE); err2 != err || calls != 0 {
+		t.Errorf("udplite again: %v with %d calls, want %v without a call", err2, calls, err)
+	}
+	if err := c.Check_protocol(ctx, govs.IPPROTO_SCTP); err != nil {
+		t.Errorf("Check_protocol sctp: %v", err)
+	}
+	if err := c.Check_protocol(ctx, govs.Protocol(200)); err == nil {
+		t.Errorf("Check_protocol 200: no error")
+	}
+
+	/* a new connection may reach another dpvs */
+	if err := c.Dial(); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Check_protocol(ctx, govs.IPPROTO_UDPLITE); err != nil {
+		t.Errorf("Check_protocol after Dial: %v", err)
+	}
+}
@@ -0,0 +1,166 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs
+
+import (
+	"context"
+	"time"
+)
+
+const (
+	RAMP_STEPS = 10 /* default weight steps of a ramp */
+)
+
+type Ramp_options struct {
+	Period   time.Duration /* from the first weight to o.Weight */
+	Interval time.Duration /* between two steps, Period/RAMP_STEPS if 0 */
+
+	/* called after every weight change with the dest and the time spent */
+	Progress func(d *Vs_dest_user_r, elapsed time.Duration)
+}
+
+func (c *Client) Ramp_dest(o *CmdOptions, opts *Ramp_options) (*Vs_dest_user_r, error) {
+	return c.Ramp_dest_ctx(context.Background(), o, opts)
+}
+
+/*
+ * Ramp_dest_ctx moves the weight of the dest o.Daddr from its live
+ * value to o.Weight linearly over opts.Period, one Set_editdest per
+ * step, keeping the other fields of the dest. Before each step the
+ * dest is read back: the ramp stops with an ErrNotExist error if it
+ * was deleted and with ErrRampAborted if its weight is not the one
+ * the ramp set last, someone else owns it now. A ramp stopped early
+ * or cancelled with ctx leaves the weight where it was.
+ */
+func (c *Client) Ramp_dest_ctx(ctx context.Context, o *CmdOptions, opts *Ramp_options) (*Vs_dest_user_r, error) {
+	if opts == nil {
+		opts = &Ramp_options{}
+	}
+	d, err := c.find_dest(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+
+	from, weight := d.Weight, d.Weight
+	start := time.Now()
+	var tick *time.Ticker
+	if opts.Period > 0 {
+		interval := opts.Interval
+		if interval <= 0 {
+			interval = opts.Period / RAMP_STEPS
+		}
+		if interval <= 0 {
+			interval = opts.Period
+		}
+		tick = time.NewTicker(interval)
+		defer tick.Stop()
+	}
+
+	for weight != o.Weight {
+		w := o.Weight
+		if tick != nil {
+			select {
+			case <-ctx.Done():
+				return d, ctx_err(ctx)
+			case <-tick.C:
+			}
+			if elapsed := time.Since(start); elapsed < opts.Period {
+				w = from + int(int64(o.Weight-from)*int64(elapsed)/int64(opts.Period))
+			}
+			if w == weight {
+				continue
+			}
+		}
+
+		if d, err = c.find_dest(ctx, o); err != nil {
+			return nil, err
+		}
+		if d.Weight != weight {
+			return d, ErrRampAborted
+		}
+
+		var reply Vs_cmd_r
+		args := Vs_dest_q{Cmd: VS_CMD_SET_DEST, Service: service_key(o), Dest: dest_user(d)}
+		args.Dest.Weight = w
+		if err := c.call(ctx, "api", args, &reply); err != nil {
+			return d, err
+		}
+		d.Weight, weight = w, w
+		if opts.Progress != nil {
+			opts.Progress(d, time.Since(start))
+		}
+	}
+	return d, nil
+}
+
+func (c *Client) Set_adddest_ramp(o *CmdOptions, opts *Ramp_options) (*Vs_dest_user_r, error) {
+	return c.Set_adddest_ramp_ctx(context.Background(), o, opts)
+}
+
+// Set_adddest_ramp_ctx adds the dest of o at weight 1 and ramps it
+// up to o.Weight, see Ramp_dest_ctx
+func (c *Client) Set_adddest_ramp_ctx(ctx context.Context, o *CmdOptions, opts *Ramp_options) (*Vs_dest_user_r, error) {
+	first := *o
+	if first.Weight > 1 {
+		first.Weight = 1
+	}
+	if _, err := c.Set_adddest_ctx(ctx, &first); err != nil {
+		return nil, err
+	}
+	return c.Ramp_dest_ctx(ctx, o, opts)
+}
+
+func (c *Client) Set_editdest_ramp(o *CmdOptions, opts *Ramp_options) (*Vs_dest_user_r, error) {
+	return c.Set_editdest_ramp_ctx(context.Background(), o, opts)
+}
+
+// Set_editdest_ramp_ctx edits the dest of o keeping its live weight,
+// at least 1, and ramps it up to o.Weight, a lower o.Weight is set
+// at once
+func (c *Client) Set_editdest_ramp_ctx(ctx context.Context, o *CmdOptions, opts *Ramp_options) (*Vs_dest_user_r, error) {
+	d, err := c.find_dest(ctx, o)
+	if err != nil {
+		return nil, err
+	}
+
+	first := *o
+	if d.Weight < o.Weight {
+		first.Weight = d.Weight
+		if first.Weight < 1 {
+			first.Weight = 1
+		}
+	}
+	if _, err := c.Set_editdest_ctx(ctx, &first); err != nil {
+		return nil, err
+	}
+	return c.Ramp_dest_ctx(ctx, o, opts)
+}
+
+func Ramp_dest(o *CmdOptions, opts *Ramp_options) (*Vs_dest_user_r, error) {
+	return DefaultClient.Ramp_dest(o, opts)
+}
+
+func Ramp_dest_ctx(ctx context.Context, o *CmdOptions, opts *Ramp_options) (*Vs_dest_user_r, error) {
+	return DefaultClient.Ramp_dest_ctx(ctx, o, opts)
+}
+
+func Set_adddest_ramp(o *CmdOptions, opts *Ramp_options) (*Vs_dest_user_r, error) {
+	return DefaultClient.Set_adddest_ramp(o, opts)
+}
+
+func Set_adddest_ramp_ctx(ctx context.Context, o *CmdOptions, opts *Ramp_options) (*Vs_dest_user_r, error) {
+	return DefaultClient.Set_adddest_ramp_ctx(ctx, o, opts)
+}
+
+func Set_editdest_ramp(o *CmdOptions, opts *Ramp_options) (*Vs_dest_user_r, error) {
+	return DefaultClient.Set_editdest_ramp(o, opts)
+}
+
+func Set_editdest_ramp_ctx(ctx context.Context, o *CmdOptions, opts *Ramp_options) (*Vs_dest_user_r, error) {
+	return DefaultClient.Set_editdest_ramp_ctx(ctx, o, opts)
+}
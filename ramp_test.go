@@ -0,0 +1,116 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs_test
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/yubo/govs"
+	"github.com/yubo/govs/govstest"
+)
+
+func ramp_setup(t *testing.T) (*govs.Client, *govs.CmdOptions) {
+	t.Helper()
+	c := govstest.NewClient(t)
+	o := options(t, "10.0.0.1:80", "192.168.1.2:80", 10)
+	if _, err := c.Set_add(o); err != nil {
+		t.Fatal(err)
+	}
+	return c, o
+}
+
+func TestRamp_dest(t *testing.T) {
+	ctx := context.Background()
+	c, o := ramp_setup(t)
+
+	var weights []int
+	opts := &govs.Ramp_options{Period: 20 * time.Millisecond, Interval: time.Millisecond,
+		Progress: func(d *govs.Vs_dest_user_r, elapsed time.Duration) {
+			weights = append(weights, d.Weight)
+		}}
+	d, err := c.Set_adddest_ramp_ctx(ctx, o, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Weight != 10 || len(weights) == 0 || weights[len(weights)-1] != 10 ||
+		!sort.IntsAreSorted(weights) || weights[0] <= 1 {
+		t.Errorf("weights %v, last %+v", weights, d)
+	}
+	if d := get_dest(t, c, o); d == nil || d.Weight != 10 || d.Conn_flags&govs.VS_CONN_F_FWD_MASK != govs.VS_CONN_F_DROUTE {
+		t.Errorf("dest %+v, want a dr dest of weight 10", d)
+	}
+
+	/* a lower weight is set at once */
+	o.Weight = 2
+	weights = nil
+	if _, err := c.Set_editdest_ramp_ctx(ctx, o, opts); err != nil || len(weights) != 0 {
+		t.Errorf("edit down: %v, weights %v", err, weights)
+	}
+	if d := get_dest(t, c, o); d == nil || d.Weight != 2 {
+		t.Errorf("dest %+v, want weight 2", d)
+	}
+}
+
+// TestRamp_dest_aborted changes the weight behind the ramp, which
+// stops and leaves it
+func TestRamp_dest_aborted(t *testing.T) {
+	ctx := context.Background()
+	c, o := ramp_setup(t)
+
+	steps := 0
+	opts := &govs.Ramp_options{Period: time.Second, Interval: time.Millisecond,
+		Progress: func(d *govs.Vs_dest_user_r, elapsed time.Duration) {
+			if steps++; steps == 1 {
+				eo := *o
+				eo.Weight = 42
+				if _, err := c.Set_editdest(&eo); err != nil {
+					t.Error(err)
+				}
+			}
+		}}
+	o.Weight = 1000
+	d, err := c.Set_adddest_ramp_ctx(ctx, o, opts)
+	if !errors.Is(err, govs.ErrRampAborted) || d == nil || d.Weight != 42 || steps != 1 {
+		t.Fatalf("got %+v, %v after %d steps, want ErrRampAborted at weight 42", d, err, steps)
+	}
+	if d := get_dest(t, c, o); d == nil || d.Weight != 42 {
+		t.Errorf("dest %+v, want weight 42", d)
+	}
+}
+
+func TestRamp_dest_deleted(t *testing.T) {
+	ctx := context.Background()
+	c, o := ramp_setup(t)
+
+	opts := &govs.Ramp_options{Period: time.Second, Interval: time.Millisecond,
+		Progress: func(d *govs.Vs_dest_user_r, elapsed time.Duration) {
+			c.Set_deldest(o)
+		}}
+	if _, err := c.Set_adddest_ramp_ctx(ctx, o, opts); !errors.Is(err, govs.ErrNotExist) {
+		t.Errorf("err %v, want ErrNotExist", err)
+	}
+}
+
+func TestRamp_dest_cancel(t *testing.T) {
+	c, o := ramp_setup(t)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+
+	o.Weight = 1000
+	d, err := c.Set_adddest_ramp_ctx(ctx, o, &govs.Ramp_options{Period: time.Hour, Interval: time.Millisecond})
+	if !errors.Is(err, govs.ErrTimeout) || d == nil {
+		t.Fatalf("got %+v, %v, want ErrTimeout", d, err)
+	}
+	if live := get_dest(t, c, o); live == nil || live.Weight != d.Weight {
+		t.Errorf("dest %+v, want the weight of the ramp %d", live, d.Weight)
+	}
+}
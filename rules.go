@@ -0,0 +1,428 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+/*
+ * The rules of ipvsadm -S -n and ipvsadm -R, with the extensions of
+ * the fullnat ipvsadm and a few of govs:
+ *
+ *   -A -t 10.0.0.1:80 -s wrr -b sh-port -p 300 -M 255.255.255.0 -o -j enable
+ *   -a -t 10.0.0.1:80 -r 192.168.1.2:8080 -b -w 10 -x 1000 -y 800
+ *   -P -t 10.0.0.1:80 -z 192.168.1.100
+ *
+ * -b is the scheduler flags of a service and fullnat on a dest, -j
+ * enables synproxy, -x/-y are the upper/lower thresholds and -P/-Q
+ * add/delete the local address -z. --sctp-service, --icmp-service,
+ * --icmpv6-service, --any-service, --dsnat and --timeout are govs'
+ * own. A dest without a forwarding method is fullnat.
+ */
+
+type rule_cmd struct {
+	cmd  int
+	opts []string
+}
+
+type rule_protocol struct {
+	protocol Protocol
+	opts     []string
+}
+
+var (
+	rule_cmds = []rule_cmd{
+		{VS_CMD_NEW_SERVICE, []string{"-A", "--add-service"}},
+		{VS_CMD_SET_SERVICE, []string{"-E", "--edit-service"}},
+		{VS_CMD_DEL_SERVICE, []string{"-D", "--delete-service"}},
+		{VS_CMD_NEW_DEST, []string{"-a", "--add-server"}},
+		{VS_CMD_SET_DEST, []string{"-e", "--edit-server"}},
+		{VS_CMD_DEL_DEST, []string{"-d", "--delete-server"}},
+		{VS_CMD_NEW_LADDR, []string{"-P", "--add-laddr"}},
+		{VS_CMD_DEL_LADDR, []string{"-Q", "--del-laddr"}},
+	}
+
+	rule_protocols = []rule_protocol{
+		{IPPROTO_TCP, []string{"-t", "--tcp-service"}},
+		{IPPROTO_UDP, []string{"-u", "--udp-service"}},
+		{IPPROTO_SCTP, []string{"--sctp-service"}},
+		{IPPROTO_ICMP, []string{"--icmp-service"}},
+		{IPPROTO_ICMPV6, []string{"--icmpv6-service"}},
+		{IPPROTO_IP, []string{"--any-service"}},
+	}
+
+	rule_fwds = [][]string{
+		FWD_FULLNAT: {"-b", "--fullnat"},
+		FWD_DR:      {"-g", "--gatewaying"},
+		FWD_TUNNEL:  {"-i", "--ipip"},
+		FWD_NAT:     {"-m", "--masquerading"},
+		FWD_DSNAT:   {"--dsnat"},
+	}
+)
+
+func rule_has(opts []string, opt string) bool {
+	for _, o := range opts {
+		if o == opt {
+			return true
+		}
+	}
+	return false
+}
+
+func is_service_cmd(cmd int) bool {
+	return cmd == VS_CMD_NEW_SERVICE || cmd == VS_CMD_SET_SERVICE || cmd == VS_CMD_DEL_SERVICE
+}
+
+func is_dest_cmd(cmd int) bool {
+	return cmd == VS_CMD_NEW_DEST || cmd == VS_CMD_SET_DEST || cmd == VS_CMD_DEL_DEST
+}
+
+func is_laddr_cmd(cmd int) bool {
+	return cmd == VS_CMD_NEW_LADDR || cmd == VS_CMD_DEL_LADDR
+}
+
+// Rule renders op in the ipvsadm -S syntax
+func (op *Op) Rule() (string, error) {
+	o := &op.O
+	var cmd, service string
+
+	for _, c := range rule_cmds {
+		if c.cmd == op.Cmd {
+			cmd = c.opts[0]
+		}
+	}
+	for _, p := range rule_protocols {
+		if p.protocol == o.Protocol {
+			service = p.opts[0]
+		}
+	}
+	if cmd == "" || service == "" {
+		return "", fmt.Errorf("%s %s: %w", Cmd_name(op.Cmd), o.Protocol, errRule)
+	}
+	r := []string{cmd, service, o.Addr.String()}
+
+	switch op.Cmd {
+	case VS_CMD_NEW_SERVICE, VS_CMD_SET_SERVICE:
+		if o.Sched_name != "" {
+			r = append(r, "-s", sched_name(o.Sched_name))
+		}
+		if opts := o.Sched_opts.String(); opts != "" {
+			r = append(r, "-b", opts)
+		}
+		if o.Flags&VS_SVC_F_PERSISTENT != 0 {
+			r = append(r, "-p", strconv.FormatUint(uint64(o.Timeout), 10))
+		} else if o.Timeout != 0 {
+			r = append(r, "--timeout", strconv.FormatUint(uint64(o.Timeout), 10))
+		}
+		if o.Netmask != 0 {
+			r = append(r, "-M", o.Netmask.String())
+		}
+		if o.Flags&VS_SVC_F_ONEPACKET != 0 {
+			r = append(r, "-o")
+		}
+		if o.Flags&VS_SVC_F_SYNPROXY != 0 {
+			r = append(r, "-j", "enable")
+		}
+		if o.Flags&VS_SVC_F_DSNAT != 0 {
+			r = append(r, "--dsnat")
+		}
+
+	case VS_CMD_NEW_DEST, VS_CMD_SET_DEST:
+		flags := dest_conn_flags(o)
+		fwd, ok := Conn_fwd(flags)
+		if !ok {
+			return "", fmt.Errorf("dest %s: fwd %s: %w", o.Daddr,
+				ConnFlags(flags&VS_CONN_F_FWD_MASK), errRule)
+		}
+		r = append(r, "-r", o.Daddr.String(), rule_fwds[fwd][0],
+			"-w", strconv.Itoa(o.Weight))
+		if o.U_threshold != 0 {
+			r = append(r, "-x", strconv.FormatUint(uint64(o.U_threshold), 10))
+		}
+		if o.L_threshold != 0 {
+			r = append(r, "-y", strconv.FormatUint(uint64(o.L_threshold), 10))
+		}
+		if flags&VS_CONN_F_SYNPROXY != 0 {
+			r = append(r, "-j", "enable")
+		}
+
+	case VS_CMD_DEL_DEST:
+		r = append(r, "-r", o.Daddr.String())
+
+	case VS_CMD_NEW_LADDR, VS_CMD_DEL_LADDR:
+		r = append(r, "-z", o.Lip.Ip_string())
+	}
+	return strings.Join(r, " "), nil
+}
+
+// Parse_rule reads a line of ipvsadm -S -n
+func Parse_rule(line string) (*Op, error) {
+	args := strings.Fields(line)
+	if len(args) == 0 {
+		return nil, errRule
+	}
+
+	op := &Op{Cmd: -1}
+	for _, c := range rule_cmds {
+		if rule_has(c.opts, args[0]) {
+			op.Cmd = c.cmd
+		}
+	}
+	if op.Cmd < 0 {
+		return nil, fmt.Errorf("%s: %w", args[0], errRule)
+	}
+
+	o := &op.O
+	/* the defaults of ipvsadm */
+	if op.Cmd == VS_CMD_NEW_SERVICE {
+		o.Sched_name = "wlc"
+	}
+	if is_dest_cmd(op.Cmd) {
+		o.Weight = 1
+	}
+	service := false
+
+	for i := 1; i < len(args); i++ {
+		opt := args[i]
+		value := func() (string, error) {
+			if i+1 >= len(args) {
+				return "", fmt.Errorf("%s: missing value: %w", opt, errRule)
+			}
+			i++
+			return args[i], nil
+		}
+		set := func(v interface{ Set(string) error }) error {
+			s, err := value()
+			if err != nil {
+				return err
+			}
+			if err := v.Set(s); err != nil {
+				return fmt.Errorf("%s %s: %w", opt, s, err)
+			}
+			return nil
+		}
+		number := func(n *uint) error {
+			s, err := value()
+			if err != nil {
+				return err
+			}
+			u, err := strconv.ParseUint(s, 10, 32)
+			if err != nil {
+				return fmt.Errorf("%s %s: %w", opt, s, errRule)
+			}
+			*n = uint(u)
+			return nil
+		}
+
+		var err error
+		switch {
+		case service_opt(opt, o):
+			if service {
+				return nil, fmt.Errorf("%s: more than one service: %w", opt, errRule)
+			}
+			service = true
+			err = set(&o.Addr)
+
+		case opt == "-f" || opt == "--fwmark-service":
+			return nil, fmt.Errorf("%s: fwmark services are not supported", opt)
+
+		case (opt == "-s" || opt == "--scheduler") && is_service_cmd(op.Cmd):
+			o.Sched_name, err = value()
+		case (opt == "-b" || opt == "--sched-flags") && is_service_cmd(op.Cmd):
+			err = set(&o.Sched_opts)
+		case opt == "-p" || opt == "--persistent":
+			o.Flags |= VS_SVC_F_PERSISTENT
+			o.Timeout = 300
+			if i+1 < len(args) && !strings.HasPrefix(args[i+1], "-") {
+				err = number(&o.Timeout)
+			}
+		case opt == "--timeout":
+			err = number(&o.Timeout)
+		case opt == "-M" || opt == "--netmask":
+			err = set(&o.Netmask)
+		case opt == "-o" || opt == "--ops":
+			o.Flags |= VS_SVC_F_ONEPACKET
+		case opt == "--dsnat" && is_service_cmd(op.Cmd):
+			o.Flags |= VS_SVC_F_DSNAT
+		case opt == "-j" || opt == "--synproxy":
+			var s string
+			if s, err = value(); err == nil && s != "enable" && s != "disable" {
+				err = fmt.Errorf("%s %s: expect enable or disable: %w", opt, s, errRule)
+			}
+			if s == "enable" && is_dest_cmd(op.Cmd) {
+				o.Conn_flags |= VS_CONN_F_SYNPROXY
+			} else if s == "enable" {
+				o.Flags |= VS_SVC_F_SYNPROXY
+			}
+
+		case opt == "-r" || opt == "--real-server":
+			err = set(&o.Daddr)
+		case fwd_opt(opt, o) && is_dest_cmd(op.Cmd):
+		case opt == "-w" || opt == "--weight":
+			var w uint
+			err = number(&w)
+			o.Weight = int(w)
+		case opt == "-x" || opt == "--u-threshold":
+			err = number(&o.U_threshold)
+		case opt == "-y" || opt == "--l-threshold":
+			err = number(&o.L_threshold)
+
+		case opt == "-z" || opt == "--laddr":
+			err = set(&o.Lip)
+
+		default:
+			return nil, fmt.Errorf("%s: unknown option: %w", opt, errRule)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case !service || o.Addr.Is_zero():
+		return nil, fmt.Errorf("no service: %w", errRule)
+	case is_dest_cmd(op.Cmd) && o.Daddr.Is_zero():
+		return nil, fmt.Errorf("no real server: %w", errRule)
+	case is_laddr_cmd(op.Cmd) && o.Lip.Is_zero():
+		return nil, fmt.Errorf("no local address: %w", errRule)
+	}
+	return op, nil
+}
+
+// service_opt sets the protocol of o if opt names a service
+func service_opt(opt string, o *CmdOptions) bool {
+	for _, p := range rule_protocols {
+		if rule_has(p.opts, opt) {
+			o.Protocol = p.protocol
+			return true
+		}
+	}
+	return false
+}
+
+// fwd_opt sets the forwarding method of o if opt names one
+func fwd_opt(opt string, o *CmdOptions) bool {
+	for fwd, opts := range rule_fwds {
+		if rule_has(opts, opt) {
+			o.Fwd = Fwd(fwd)
+			return true
+		}
+	}
+	return false
+}
+
+// Rules lists the commands which add the services, dests and local
+// addresses of cfg, each service followed by its laddrs, which its
+// fullnat dests need, then its dests
+func (cfg *Config) Rules() []*Op {
+	var ops []*Op
+	for i := range cfg.Services {
+		s := &cfg.Services[i]
+		o := s.options()
+		if s.Sched == "" {
+			o.Sched_name = ""
+		}
+		ops = append(ops, &Op{Cmd: VS_CMD_NEW_SERVICE, O: o})
+		for _, l := range s.Laddrs {
+			lo := o
+			lo.Lip = l
+			ops = append(ops, &Op{Cmd: VS_CMD_NEW_LADDR, O: lo})
+		}
+		for j := range s.Dests {
+			ops = append(ops, &Op{Cmd: VS_CMD_NEW_DEST, O: s.Dests[j].options(&o)})
+		}
+	}
+	return ops
+}
+
+// Save writes the services, dests and local addresses of dpvs to w
+// as ipvsadm rules, see Restore
+func (c *Client) Save(ctx context.Context, w io.Writer) error {
+	cfg, err := c.Get_config(ctx)
+	if err != nil {
+		return err
+	}
+	for _, op := range cfg.Rules() {
+		rule, err := op.Rule()
+		if err != nil {
+			return fmt.Errorf("%s: %w", svc_key{op.O.Protocol, op.O.Addr}, err)
+		}
+		if _, err := fmt.Fprintln(w, rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore replays the ipvsadm rules of r one by one, it stops at the
+// first failure and returns the number of rules applied. Blank lines
+// and '#' comments are skipped.
+func (c *Client) Restore(ctx context.Context, r io.Reader) (n int, err error) {
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		op, err := Parse_rule(text)
+		if err == nil {
+			err = c.Exec(ctx, op)
+		}
+		if err != nil {
+			return n, fmt.Errorf("line %d: %w", line, err)
+		}
+		n++
+	}
+	return n, scanner.Err()
+}
+
+// Exec sends the command of op, a dest it makes fullnat needs a local
+// address of its service first, see Check_laddrs_ctx
+func (c *Client) Exec(ctx context.Context, op *Op) (err error) {
+	o := &op.O
+	switch op.Cmd {
+	case VS_CMD_NEW_SERVICE:
+		_, err = c.Set_add_ctx(ctx, o)
+	case VS_CMD_SET_SERVICE:
+		_, err = c.Set_edit_ctx(ctx, o)
+	case VS_CMD_DEL_SERVICE:
+		_, err = c.Set_del_ctx(ctx, o)
+	case VS_CMD_NEW_DEST:
+		if err = c.check_dest_laddrs(ctx, op.Cmd, o); err == nil {
+			_, err = c.Set_adddest_ctx(ctx, o)
+		}
+	case VS_CMD_SET_DEST:
+		if err = c.check_dest_laddrs(ctx, op.Cmd, o); err == nil {
+			_, err = c.Set_editdest_ctx(ctx, o)
+		}
+	case VS_CMD_DEL_DEST:
+		_, err = c.Set_deldest_ctx(ctx, o)
+	case VS_CMD_NEW_LADDR:
+		_, err = c.Set_addladdr_ctx(ctx, o)
+	case VS_CMD_DEL_LADDR:
+		_, err = c.Set_delladdr_ctx(ctx, o)
+	default:
+		err = fmt.Errorf("%s: %w", Cmd_name(op.Cmd), errRule)
+	}
+	return err
+}
+
+func Save(ctx context.Context, w io.Writer) error {
+	return DefaultClient.Save(ctx, w)
+}
+
+func Restore(ctx context.Context, r io.Reader) (int, error) {
+	return DefaultClient.Restore(ctx, r)
+}
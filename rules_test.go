@@ -0,0 +1,171 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/yubo/govs"
+	"github.com/yubo/govs/govstest"
+)
+
+func TestParse_rule(t *testing.T) {
+	for _, c := range []struct {
+		rule  string
+		cmd   int
+		check func(o *govs.CmdOptions) bool
+	}{
+		/* the defaults of ipvsadm */
+		{"-A -t 10.0.0.1:80", govs.VS_CMD_NEW_SERVICE, func(o *govs.CmdOptions) bool {
+			return o.Protocol == govs.IPPROTO_TCP && o.Sched_name == "wlc" && o.Flags == 0
+		}},
+		{"-a -t 10.0.0.1:80 -r 192.168.1.2:8080", govs.VS_CMD_NEW_DEST, func(o *govs.CmdOptions) bool {
+			return o.Weight == 1 && o.Fwd == govs.FWD_UNSET
+		}},
+		{"-e -t 10.0.0.1:80 -r 192.168.1.2:8080", govs.VS_CMD_SET_DEST, func(o *govs.CmdOptions) bool {
+			return o.Weight == 1 && o.Fwd == govs.FWD_UNSET
+		}},
+		{"-E -u 10.0.0.1:53", govs.VS_CMD_SET_SERVICE, func(o *govs.CmdOptions) bool {
+			return o.Protocol == govs.IPPROTO_UDP && o.Sched_name == ""
+		}},
+
+		/* -b is the scheduler flags of a service, fullnat on a dest */
+		{"-A -t 10.0.0.1:80 -s mh -b mh-fallback,mh-port", govs.VS_CMD_NEW_SERVICE, func(o *govs.CmdOptions) bool {
+			return o.Sched_name == "mh" && o.Sched_opts.String() == "mh-fallback,mh-port"
+		}},
+		{"-a -t 10.0.0.1:80 -r 192.168.1.2:8080 -b -w 10", govs.VS_CMD_NEW_DEST, func(o *govs.CmdOptions) bool {
+			return o.Fwd == govs.FWD_FULLNAT && o.Weight == 10
+		}},
+		{"-a -t 10.0.0.1:80 -r 192.168.1.2:8080 -g -w 0 -x 1000 -y 800 -j enable", govs.VS_CMD_NEW_DEST, func(o *govs.CmdOptions) bool {
+			return o.Fwd == govs.FWD_DR && o.Weight == 0 && o.U_threshold == 1000 &&
+				o.L_threshold == 800 && o.Conn_flags == govs.VS_CONN_F_SYNPROXY
+		}},
+		{"--add-server --tcp-service 10.0.0.1:80 --real-server 192.168.1.2 --ipip", govs.VS_CMD_NEW_DEST, func(o *govs.CmdOptions) bool {
+			return o.Fwd == govs.FWD_TUNNEL && o.Daddr.Port == 0
+		}},
+
+		{"-A -t 10.0.0.1:80 -s wrr -p", govs.VS_CMD_NEW_SERVICE, func(o *govs.CmdOptions) bool {
+			return o.Flags == govs.VS_SVC_F_PERSISTENT && o.Timeout == 300
+		}},
+		{"-A -t 10.0.0.1:80 -p 60 -M 255.255.255.0 -o -j enable", govs.VS_CMD_NEW_SERVICE, func(o *govs.CmdOptions) bool {
+			return o.Flags == govs.VS_SVC_F_PERSISTENT|govs.VS_SVC_F_ONEPACKET|govs.VS_SVC_F_SYNPROXY &&
+				o.Timeout == 60 && o.Netmask.String() == "255.255.255.0"
+		}},
+		{"-A --sctp-service [2001:db8::1]:443 --timeout 30", govs.VS_CMD_NEW_SERVICE, func(o *govs.CmdOptions) bool {
+			return o.Protocol == govs.IPPROTO_SCTP && o.Addr.Af == govs.AF_INET6 &&
+				o.Timeout == 30 && o.Flags == 0
+		}},
+		{"-P -t 10.0.0.1:80 -z 192.168.1.100", govs.VS_CMD_NEW_LADDR, func(o *govs.CmdOptions) bool {
+			return o.Lip.Ip_string() == "192.168.1.100"
+		}},
+	} {
+		op, err := govs.Parse_rule(c.rule)
+		if err != nil {
+			t.Errorf("%s: %v", c.rule, err)
+			continue
+		}
+		if op.Cmd != c.cmd || !c.check(&op.O) {
+			t.Errorf("%s: got %s %+v", c.rule, govs.Cmd_name(op.Cmd), op.O)
+		}
+	}
+}
+
+func TestParse_rule_error(t *testing.T) {
+	for _, c := range []struct {
+		rule string
+		err  string
+	}{
+		{"", "not an ipvsadm rule"},
+		{"-X -t 10.0.0.1:80", "-X"},
+		{"-A -f 1", "fwmark services are not supported"},
+		{"-A -s wrr", "no service"},
+		{"-A -t 10.0.0.1:80 -u 10.0.0.1:53", "more than one service"},
+		{"-a -t 10.0.0.1:80 -w 1", "no real server"},
+		{"-P -t 10.0.0.1:80", "no local address"},
+		{"-A -t 10.0.0.1:80 -s", "missing value"},
+		{"-A -t 10.0.0.1:80 -j maybe", "expect enable or disable"},
+		{"-a -t 10.0.0.1:80 -r 192.168.1.2 -w x", "-w x"},
+		{"-A -t 10.0.0.1:80 -r", "missing value"},
+		{"-A -t 10.0.0.1:80 -g", "unknown option"},
+		{"-A -t 10.0.0.1:x", "-t 10.0.0.1:x"},
+	} {
+		_, err := govs.Parse_rule(c.rule)
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%q: err %v, want %q", c.rule, err, c.err)
+		}
+	}
+}
+
+const rules = `-A -t 10.0.0.1:80 -s wrr -p 300
+-P -t 10.0.0.1:80 -z 192.168.1.100
+-a -t 10.0.0.1:80 -r 192.168.1.2:8080 -b -w 10 -x 1000 -y 800
+-a -t 10.0.0.1:80 -r 192.168.1.3:8080 -g -w 5 -j enable
+-A --sctp-service [2001:db8::1]:443 -s mh -b mh-fallback,mh-table=65537
+-a --sctp-service [2001:db8::1]:443 -r [2001:db8::2]:443 -i -w 1
+`
+
+func TestSave_restore(t *testing.T) {
+	ctx := context.Background()
+	from, to := govstest.NewClient(t), govstest.NewClient(t)
+
+	in := "# saved by hand\n\n" + rules
+	if n, err := from.Restore(ctx, strings.NewReader(in)); err != nil || n != 6 {
+		t.Fatalf("restore: %d rules, %v", n, err)
+	}
+	var out bytes.Buffer
+	if err := from.Save(ctx, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != rules {
+		t.Fatalf("save\ngot\n%s\nwant\n%s", out.String(), rules)
+	}
+
+	/* the saved rules restore on another dpvs */
+	if n, err := to.Restore(ctx, &out); err != nil || n != 6 {
+		t.Fatalf("restore the saved rules: %d rules, %v", n, err)
+	}
+	out.Reset()
+	if err := to.Save(ctx, &out); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != rules {
+		t.Errorf("save after restore\ngot\n%s\nwant\n%s", out.String(), rules)
+	}
+}
+
+func TestRestore_error(t *testing.T) {
+	ctx := context.Background()
+
+	for _, c := range []struct {
+		name  string
+		rules string
+		n     int
+		err   error
+		msg   string
+	}{
+		{"fullnat dest before the laddr", "-A -t 10.0.0.1:80\n" +
+			"-a -t 10.0.0.1:80 -r 192.168.1.2:8080\n" +
+			"-P -t 10.0.0.1:80 -z 192.168.1.100\n", 1, govs.ErrNoLaddr, "line 2"},
+		{"edit to fullnat without laddr", "-A -t 10.0.0.1:80\n" +
+			"-a -t 10.0.0.1:80 -r 192.168.1.2:8080 -g\n" +
+			"-e -t 10.0.0.1:80 -r 192.168.1.2:8080 -w 3\n" +
+			"-e -t 10.0.0.1:80 -r 192.168.1.2:8080 -b\n", 3, govs.ErrNoLaddr, "line 4"},
+		{"missing service", "\n-a -t 10.0.0.1:80 -r 192.168.1.2:8080 -g\n", 0, govs.ErrNotExist, "line 2"},
+		{"bad rule", "-A -t 10.0.0.1:80\n-A -t\n", 1, nil, "line 2: -t: missing value"},
+	} {
+		n, err := govstest.NewClient(t).Restore(ctx, strings.NewReader(c.rules))
+		if err == nil || n != c.n || (c.err != nil && !errors.Is(err, c.err)) ||
+			!strings.Contains(err.Error(), c.msg) {
+			t.Errorf("%s: %d rules, %v, want %d rules, %v %q", c.name, n, err, c.n, c.err, c.msg)
+		}
+	}
+}
@@ -0,0 +1,207 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	/* Sched_flags of a service, the options of sh and mh */
+	VS_SCHED_F_FALLBACK = 0x0001 /* skip overloaded or zero weight dests */
+	VS_SCHED_F_PORT     = 0x0002 /* hash the source port too */
+
+	MH_TABLE_SIZE = 65537 /* default mh lookup table size */
+	MH_TABLE_MAX  = 1 << 20
+)
+
+type Sched struct {
+	Name    string
+	Aliases []string
+	Desc    string
+	Flags   uint /* VS_SCHED_F_* it takes */
+	Table   bool /* it takes a lookup table size */
+}
+
+var schedulers = []Sched{
+	{Name: "rr", Desc: "round robin"},
+	{Name: "wrr", Desc: "weighted round robin"},
+	{Name: "lc", Desc: "least connection"},
+	{Name: "wlc", Desc: "weighted least connection"},
+	{Name: "sed", Desc: "shortest expected delay"},
+	{Name: "nq", Desc: "never queue"},
+	{Name: "sh", Desc: "source hashing",
+		Flags: VS_SCHED_F_FALLBACK | VS_SCHED_F_PORT},
+	{Name: "dh", Desc: "destination hashing"},
+	{Name: "mh", Aliases: []string{"maglev"}, Desc: "maglev hashing",
+		Flags: VS_SCHED_F_FALLBACK | VS_SCHED_F_PORT, Table: true},
+}
+
+var sched_flag_names = []flag_name{
+	{VS_SCHED_F_FALLBACK, "fallback"},
+	{VS_SCHED_F_PORT, "port"},
+}
+
+// Schedulers returns the schedulers govs knows about
+func Schedulers() []Sched {
+	return append([]Sched{}, schedulers...)
+}
+
+// Find_sched looks up a scheduler by name or alias
+func Find_sched(name string) (*Sched, error) {
+	name = strings.ToLower(name)
+	for i := range schedulers {
+		s := &schedulers[i]
+		if s.Name == name {
+			return s, nil
+		}
+		for _, alias := range s.Aliases {
+			if alias == name {
+				return s, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%w %q", errSched, name)
+}
+
+// Options lists the options of s in the Sched_opts syntax
+func (s *Sched) Options() string {
+	var opts []string
+	for _, f := range sched_flag_names {
+		if s.Flags&f.flag != 0 {
+			opts = append(opts, s.Name+"-"+f.name)
+		}
+	}
+	if s.Table {
+		opts = append(opts, s.Name+"-table=N")
+	}
+	return strings.Join(opts, ",")
+}
+
+/*
+ * Sched_opts are the scheduler options of a service,
+ * sh-fallback,sh-port or mh-fallback,mh-port,mh-table=65537
+ */
+type Sched_opts struct {
+	Sched string /* the scheduler named by the options */
+	Flags uint
+	Table uint32
+}
+
+func (p *Sched_opts) Set(value string) error {
+	*p = Sched_opts{}
+
+next:
+	for _, opt := range split_flags(value) {
+		i := strings.Index(opt, "-")
+		if i <= 0 {
+			return errSchedOpts
+		}
+		sched, name := opt[:i], opt[i+1:]
+		if p.Sched != "" && p.Sched != sched {
+			return errSchedOpts
+		}
+		p.Sched = sched
+
+		if strings.HasPrefix(name, "table=") {
+			n, err := strconv.ParseUint(name[len("table="):], 10, 32)
+			if err != nil {
+				return errSchedOpts
+			}
+			p.Table = uint32(n)
+			continue
+		}
+		for _, f := range sched_flag_names {
+			if f.name == name {
+				p.Flags |= f.flag
+				continue next
+			}
+		}
+		return errSchedOpts
+	}
+	return nil
+}
+
+func (p Sched_opts) String() string {
+	var opts []string
+	for _, f := range sched_flag_names {
+		if p.Flags&f.flag != 0 {
+			opts = append(opts, p.Sched+"-"+f.name)
+		}
+	}
+	if p.Table != 0 {
+		opts = append(opts, fmt.Sprintf("%s-table=%d", p.Sched, p.Table))
+	}
+	return strings.Join(opts, ",")
+}
+
+func (p Sched_opts) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Sched_opts) UnmarshalText(text []byte) error {
+	return p.Set(string(text))
+}
+
+func is_prime(n uint32) bool {
+	if n < 2 {
+		return false
+	}
+	for i := uint32(2); i*i <= n; i++ {
+		if n%i == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Check validates the options of a service with the scheduler s
+func (s *Sched) Check(opts *Sched_opts) error {
+	if opts.Sched != "" {
+		if o, err := Find_sched(opts.Sched); err != nil || o != s {
+			return fmt.Errorf("%s options for scheduler %s: %w",
+				opts.Sched, s.Name, errSchedOpts)
+		}
+	}
+	if opts.Flags&^s.Flags != 0 {
+		return fmt.Errorf("%s takes no %s: %w", s.Name, opts, errSchedOpts)
+	}
+	if opts.Table != 0 {
+		if !s.Table {
+			return fmt.Errorf("%s takes no lookup table: %w", s.Name, errSchedOpts)
+		}
+		if opts.Table > MH_TABLE_MAX || !is_prime(opts.Table) {
+			return fmt.Errorf("table size %d is not a prime up to %d: %w",
+				opts.Table, MH_TABLE_MAX, errSchedOpts)
+		}
+	}
+	return nil
+}
+
+// check_sched validates the scheduler and its options of o before
+// VS_CMD_NEW_SERVICE or VS_CMD_SET_SERVICE
+func check_sched(o *CmdOptions) error {
+	if o.Sched_name == "" && o.Sched_opts == (Sched_opts{}) {
+		return nil /* dpvs picks */
+	}
+	s, err := Find_sched(o.Sched_name)
+	if err != nil {
+		return err
+	}
+	return s.Check(&o.Sched_opts)
+}
+
+// sched_name sends the canonical name of an alias
+func sched_name(name string) string {
+	if s, err := Find_sched(name); err == nil {
+		return s.Name
+	}
+	return name
+}
@@ -8,42 +8,66 @@
 package govs
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"strings"
 )
 
 type Vs_service_user struct {
-	Nic        uint8
-	Protocol   uint8
-	Addr       Be32
-	Port       Be16
-	Sched_name string
-	Flags      uint
-	Timeout    uint
-	Netmask    Be32
-	Number     int /* max list laddr/dests */
+	Nic         uint8
+	Af          uint16
+	Protocol    uint8
+	Addr        Be32
+	Addr6       In6_addr
+	Port        Be16
+	Sched_name  string
+	Sched_flags uint   `json:",omitempty"` /* sh and mh only */
+	Sched_table uint32 `json:",omitempty"`
+	Flags       uint
+	Timeout     uint
+	Netmask     Be32
+	Number      int /* max list laddr/dests */
+}
+
+// MarshalJSON leaves Af and Addr6 out of an ipv4 service, the wire
+// format of dpvs without ipv6 support
+func (u Vs_service_user) MarshalJSON() ([]byte, error) {
+	type user Vs_service_user
+	if u.Af == AF_INET6 {
+		return json.Marshal(user(u))
+	}
+	return json.Marshal(struct {
+		user
+		Af    *uint16   `json:",omitempty"`
+		Addr6 *In6_addr `json:",omitempty"`
+	}{user: user(u)})
 }
 
 type Vs_service_user_r struct {
-	Protocol   uint8
-	Addr       Be32
-	Port       Be16
-	Sched_name string
-	Flags      uint32
-	Timeout    uint32
-	Netmask    Be32
-	Conns      uint64
-	Inpkts     uint64
-	Outpkts    uint64
-	Inbytes    uint64
-	Outbytes   uint64
-	Num_dests  uint32
-	Num_laddrs uint32
+	Af          uint16
+	Protocol    uint8
+	Addr        Be32
+	Addr6       In6_addr
+	Port        Be16
+	Sched_name  string
+	Sched_flags uint32
+	Sched_table uint32
+	Flags       uint32
+	Timeout     uint32
+	Netmask     Be32
+	Conns       uint64
+	Inpkts      uint64
+	Outpkts     uint64
+	Inbytes     uint64
+	Outbytes    uint64
+	Num_dests   uint32
+	Num_laddrs  uint32
 }
 
 const (
-	fmt_svc_t = "%5s %21s %8s %8s %15s %6s %6s %5s %7s %10s %10s %10s %10s"
-	fmt_svc   = "%5s %21s %08x %8d %15s %6d %6d %5s %7d %10d %10d %10d %10d"
+	fmt_svc_t = "%7s %47s %20s %8s %15s %6s %6s %5s %7s %10s %10s %10s %10s"
+	fmt_svc   = "%7s %47s %20s %8d %15s %6d %6d %5s %7d %10d %10d %10d %10d"
 )
 
 func Svc_title() string {
@@ -56,13 +80,18 @@ func Svc_title() string {
 func (svc Vs_service_user_r) String() string {
 	return fmt.Sprintf(fmt_svc,
 		get_protocol_name(svc.Protocol),
-		fmt.Sprintf("%s:%s", svc.Addr.String(), svc.Port.String()), svc.Flags,
+		svc.Address().String(), SvcFlags(svc.Flags),
 		svc.Timeout, svc.Netmask.String(),
 		svc.Num_dests, svc.Num_laddrs, svc.Sched_name,
 		svc.Conns, svc.Inpkts, svc.Outpkts,
 		svc.Inbytes, svc.Outbytes)
 }
 
+// Address returns the address and port of the service
+func (svc *Vs_service_user_r) Address() Inet_addr {
+	return inet_addr(svc.Af, svc.Addr, svc.Addr6, svc.Port)
+}
+
 type Vs_list_q struct {
 	Cmd          int
 	Num_services int
@@ -81,7 +110,7 @@ func (r Vs_list_service_r) String() string {
 	if r.Code == 0 {
 		return r.Service.String()
 	} else {
-		return fmt.Sprintf("%s:%s", Ecode(r.Code), r.Msg)
+		return errstr(r.Code, r.Msg)
 	}
 }
 
@@ -94,7 +123,7 @@ type Vs_list_services_r struct {
 
 func (r Vs_list_services_r) String() (s string) {
 	if r.Code != 0 {
-		return fmt.Sprintf("%s:%s", Ecode(r.Code), r.Msg)
+		return errstr(r.Code, r.Msg)
 	}
 	for _, svc := range r.Services {
 		s += fmt.Sprintf("%s\n", svc)
@@ -107,85 +136,150 @@ type Vs_service_q struct {
 	Service Vs_service_user
 }
 
-func Get_services(o *CmdOptions) (*Vs_list_services_r, error) {
+// service_key identifies the service of o
+func service_key(o *CmdOptions) Vs_service_user {
+	return Vs_service_user{
+		Af:       o.Addr.af(),
+		Protocol: uint8(o.Protocol),
+		Addr:     o.Addr.Ip,
+		Addr6:    o.Addr.Ip6,
+		Port:     o.Addr.Port,
+	}
+}
+
+func service_q(cmd int, o *CmdOptions) Vs_service_q {
+	args := Vs_service_q{Cmd: cmd, Service: service_key(o)}
+	if cmd == VS_CMD_DEL_SERVICE {
+		return args
+	}
+
+	args.Service.Nic = uint8(o.Nic)
+	args.Service.Sched_name = sched_name(o.Sched_name)
+	args.Service.Sched_flags = o.Sched_opts.Flags
+	args.Service.Sched_table = o.Sched_opts.Table
+	args.Service.Flags = uint(o.Flags)
+	args.Service.Timeout = o.Timeout
+	args.Service.Netmask = o.Netmask
+	return args
+}
+
+func (c *Client) Get_services(o *CmdOptions) (*Vs_list_services_r, error) {
+	return c.Get_services_ctx(context.Background(), o)
+}
+
+func (c *Client) Get_services_ctx(ctx context.Context, o *CmdOptions) (*Vs_list_services_r, error) {
 	var reply Vs_list_services_r
 
 	args := Vs_list_q{
 		Cmd: VS_CMD_GET_SERVICES,
 	}
 
-	err := client.Call("api", args, &reply)
+	err := c.call(ctx, "api", args, &reply)
 	return &reply, err
 }
 
-func Get_service(o *CmdOptions) (*Vs_list_service_r, error) {
+func (c *Client) Get_service(o *CmdOptions) (*Vs_list_service_r, error) {
+	return c.Get_service_ctx(context.Background(), o)
+}
+
+func (c *Client) Get_service_ctx(ctx context.Context, o *CmdOptions) (*Vs_list_service_r, error) {
 	var reply Vs_list_service_r
 	args := Vs_list_q{
-		Cmd: VS_CMD_GET_SERVICE,
-		Service: Vs_service_user{
-			Addr:     o.Addr.Ip,
-			Port:     o.Addr.Port,
-			Protocol: uint8(o.Protocol),
-		},
+		Cmd:     VS_CMD_GET_SERVICE,
+		Service: service_key(o),
 	}
-	fmt.Printf("ip:%s, port:%d, protocol: %d\n",
-		args.Service.Addr.String(), args.Service.Port, args.Service.Protocol)
 
-	err := client.Call("api", args, &reply)
+	err := c.call(ctx, "api", args, &reply)
 	return &reply, err
 }
 
-func Set_add(o *CmdOptions) (*Vs_cmd_r, error) {
+func (c *Client) Set_add(o *CmdOptions) (*Vs_cmd_r, error) {
+	return c.Set_add_ctx(context.Background(), o)
+}
+
+// Set_add_ctx checks the scheduler and the protocol first, see
+// Check_protocol.
+func (c *Client) Set_add_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
 	var reply Vs_cmd_r
-	args := Vs_service_q{
-		Cmd: VS_CMD_NEW_SERVICE,
-		Service: Vs_service_user{
-			Nic:        uint8(o.Nic),
-			Protocol:   uint8(o.Protocol),
-			Addr:       o.Addr.Ip,
-			Port:       o.Addr.Port,
-			Sched_name: o.Sched_name,
-			Flags:      o.Flags,
-			Timeout:    o.Timeout,
-			Netmask:    o.Netmask,
-		},
+	args := service_q(VS_CMD_NEW_SERVICE, o)
+
+	if err := check_sched(o); err != nil {
+		return nil, err
+	}
+	if err := c.Check_protocol(ctx, o.Protocol); err != nil {
+		return nil, err
 	}
 
-	err := client.Call("api", args, &reply)
-	return &reply, err
+	if err := c.call(ctx, "api", args, &reply); err != nil {
+		return &reply, c.refuse_protocol(ctx, o.Protocol, err)
+	}
+	return &reply, nil
 }
 
-func Set_edit(o *CmdOptions) (*Vs_cmd_r, error) {
+func (c *Client) Set_edit(o *CmdOptions) (*Vs_cmd_r, error) {
+	return c.Set_edit_ctx(context.Background(), o)
+}
+
+func (c *Client) Set_edit_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
 	var reply Vs_cmd_r
-	args := Vs_service_q{
-		Cmd: VS_CMD_SET_SERVICE,
-		Service: Vs_service_user{
-			Nic:        uint8(o.Nic),
-			Protocol:   uint8(o.Protocol),
-			Addr:       o.Addr.Ip,
-			Port:       o.Addr.Port,
-			Sched_name: o.Sched_name,
-			Flags:      o.Flags,
-			Timeout:    o.Timeout,
-			Netmask:    o.Netmask,
-		},
+	args := service_q(VS_CMD_SET_SERVICE, o)
+
+	if err := check_sched(o); err != nil {
+		return nil, err
 	}
 
-	err := client.Call("api", args, &reply)
+	err := c.call(ctx, "api", args, &reply)
 	return &reply, err
 }
 
-func Set_del(o *CmdOptions) (*Vs_cmd_r, error) {
+func (c *Client) Set_del(o *CmdOptions) (*Vs_cmd_r, error) {
+	return c.Set_del_ctx(context.Background(), o)
+}
+
+func (c *Client) Set_del_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
 	var reply Vs_cmd_r
-	args := Vs_service_q{
-		Cmd: VS_CMD_DEL_SERVICE,
-		Service: Vs_service_user{
-			Protocol: uint8(o.Protocol),
-			Addr:     o.Addr.Ip,
-			Port:     o.Addr.Port,
-		},
-	}
+	args := service_q(VS_CMD_DEL_SERVICE, o)
 
-	err := client.Call("api", args, &reply)
+	err := c.call(ctx, "api", args, &reply)
 	return &reply, err
 }
+
+func Get_services(o *CmdOptions) (*Vs_list_services_r, error) {
+	return DefaultClient.Get_services(o)
+}
+
+func Get_services_ctx(ctx context.Context, o *CmdOptions) (*Vs_list_services_r, error) {
+	return DefaultClient.Get_services_ctx(ctx, o)
+}
+
+func Get_service(o *CmdOptions) (*Vs_list_service_r, error) {
+	return DefaultClient.Get_service(o)
+}
+
+func Get_service_ctx(ctx context.Context, o *CmdOptions) (*Vs_list_service_r, error) {
+	return DefaultClient.Get_service_ctx(ctx, o)
+}
+
+func Set_add(o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_add(o)
+}
+
+func Set_add_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_add_ctx(ctx, o)
+}
+
+func Set_edit(o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_edit(o)
+}
+
+func Set_edit_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_edit_ctx(ctx, o)
+}
+
+func Set_del(o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_del(o)
+}
+
+func Set_del_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Set_del_ctx(ctx, o)
+}
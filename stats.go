@@ -7,7 +7,10 @@
  */
 package govs
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+)
 
 const (
 	VS_CTL_S_SYNC = iota
@@ -58,7 +61,7 @@ id kni_deq kni_err  k_rx rx_d tx tx_d
 */
 func (r Vs_stats_io_r) String() string {
 	if r.Code != 0 {
-		return fmt.Sprintf("%s:%s", Ecode(r.Code), r.Msg)
+		return errstr(r.Code, r.Msg)
 	}
 	var ret string
 
@@ -135,7 +138,7 @@ type Vs_stats_worker_r struct {
 
 func (r Vs_stats_worker_r) String() string {
 	if r.Code != 0 {
-		return fmt.Sprintf("%s:%s", Ecode(r.Code), r.Msg)
+		return errstr(r.Code, r.Msg)
 	}
 	var ret string
 
@@ -229,7 +232,7 @@ type Vs_estats_worker_r struct {
 
 func (r Vs_estats_worker_r) String() (ret string) {
 	if r.Code != 0 {
-		return fmt.Sprintf("%s:%s", Ecode(r.Code), r.Msg)
+		return errstr(r.Code, r.Msg)
 	}
 
 	if len(r.Worker) == 0 {
@@ -266,7 +269,7 @@ type Vs_stats_dev_r struct {
 
 func (r Vs_stats_dev_r) String() string {
 	if r.Code != 0 {
-		return fmt.Sprintf("%s:%s", Ecode(r.Code), r.Msg)
+		return errstr(r.Code, r.Msg)
 	}
 	ret := fmt.Sprintf("%-10s %10s %10s %10s %10s %10s %10s %10s %10s\n",
 		"port_id", "ipackets", "opackets", "ibytes", "obytes",
@@ -300,7 +303,7 @@ id                seq      n_svc      state
 */
 func (r Vs_stats_ctl_r) String() string {
 	if r.Code != 0 {
-		return fmt.Sprintf("%s:%s", Ecode(r.Code), r.Msg)
+		return errstr(r.Code, r.Msg)
 	}
 	ret := fmt.Sprintf("%-10s %10s %10s %10s\n",
 		"id", "seq", "n_svc", "state")
@@ -336,7 +339,7 @@ type Vs_stats_mem_r struct {
 
 func (r Vs_stats_mem_r) String() string {
 	if r.Code != 0 {
-		return fmt.Sprintf("%s:%s", Ecode(r.Code), r.Msg)
+		return errstr(r.Code, r.Msg)
 	}
 	ret := fmt.Sprintf("%-10s %10s %10s %10s %10s %10s\n",
 		"id", "mbuf", "svc", "rs", "laddr", "conn")
@@ -370,50 +373,122 @@ func ctl_state_name(s int) byte {
 		return '-'
 	}
 }
-func Get_stats_io(id int) (*Vs_stats_io_r, error) {
+func (c *Client) Get_stats_io(id int) (*Vs_stats_io_r, error) {
+	return c.Get_stats_io_ctx(context.Background(), id)
+}
+
+func (c *Client) Get_stats_io_ctx(ctx context.Context, id int) (*Vs_stats_io_r, error) {
 	args := Vs_stats_q{Type: VS_STATS_IO, Id: id}
 	reply := &Vs_stats_io_r{}
 
-	err := client.Call("stats", args, reply)
+	err := c.call(ctx, "stats", args, reply)
 	return reply, err
 }
 
-func Get_stats_worker(id int) (*Vs_stats_worker_r, error) {
+func (c *Client) Get_stats_worker(id int) (*Vs_stats_worker_r, error) {
+	return c.Get_stats_worker_ctx(context.Background(), id)
+}
+
+func (c *Client) Get_stats_worker_ctx(ctx context.Context, id int) (*Vs_stats_worker_r, error) {
 	args := Vs_stats_q{Type: VS_STATS_WORKER, Id: id}
 	reply := &Vs_stats_worker_r{}
 
-	err := client.Call("stats", args, reply)
+	err := c.call(ctx, "stats", args, reply)
 	return reply, err
 }
 
-func Get_estats_worker(id int) (*Vs_estats_worker_r, error) {
+func (c *Client) Get_estats_worker(id int) (*Vs_estats_worker_r, error) {
+	return c.Get_estats_worker_ctx(context.Background(), id)
+}
+
+func (c *Client) Get_estats_worker_ctx(ctx context.Context, id int) (*Vs_estats_worker_r, error) {
 	args := Vs_stats_q{Type: VS_ESTATS_WORKER, Id: id}
 	reply := &Vs_estats_worker_r{}
 
-	err := client.Call("stats", args, reply)
+	err := c.call(ctx, "stats", args, reply)
 	return reply, err
 }
 
-func Get_stats_dev(id int) (*Vs_stats_dev_r, error) {
+func (c *Client) Get_stats_dev(id int) (*Vs_stats_dev_r, error) {
+	return c.Get_stats_dev_ctx(context.Background(), id)
+}
+
+func (c *Client) Get_stats_dev_ctx(ctx context.Context, id int) (*Vs_stats_dev_r, error) {
 	args := Vs_stats_q{Type: VS_STATS_DEV, Id: id}
 	reply := &Vs_stats_dev_r{}
 
-	err := client.Call("stats", args, reply)
+	err := c.call(ctx, "stats", args, reply)
 	return reply, err
 }
 
-func Get_stats_ctl() (*Vs_stats_ctl_r, error) {
+func (c *Client) Get_stats_ctl() (*Vs_stats_ctl_r, error) {
+	return c.Get_stats_ctl_ctx(context.Background())
+}
+
+func (c *Client) Get_stats_ctl_ctx(ctx context.Context) (*Vs_stats_ctl_r, error) {
 	args := Vs_stats_q{Type: VS_STATS_CTL}
 	reply := &Vs_stats_ctl_r{}
 
-	err := client.Call("stats", args, reply)
+	err := c.call(ctx, "stats", args, reply)
 	return reply, err
 }
 
-func Get_stats_mem() (*Vs_stats_mem_r, error) {
+func (c *Client) Get_stats_mem() (*Vs_stats_mem_r, error) {
+	return c.Get_stats_mem_ctx(context.Background())
+}
+
+func (c *Client) Get_stats_mem_ctx(ctx context.Context) (*Vs_stats_mem_r, error) {
 	args := Vs_stats_q{Type: VS_STATS_MEM}
 	reply := &Vs_stats_mem_r{}
 
-	err := client.Call("stats", args, reply)
+	err := c.call(ctx, "stats", args, reply)
 	return reply, err
 }
+
+func Get_stats_io(id int) (*Vs_stats_io_r, error) {
+	return DefaultClient.Get_stats_io(id)
+}
+
+func Get_stats_io_ctx(ctx context.Context, id int) (*Vs_stats_io_r, error) {
+	return DefaultClient.Get_stats_io_ctx(ctx, id)
+}
+
+func Get_stats_worker(id int) (*Vs_stats_worker_r, error) {
+	return DefaultClient.Get_stats_worker(id)
+}
+
+func Get_stats_worker_ctx(ctx context.Context, id int) (*Vs_stats_worker_r, error) {
+	return DefaultClient.Get_stats_worker_ctx(ctx, id)
+}
+
+func Get_estats_worker(id int) (*Vs_estats_worker_r, error) {
+	return DefaultClient.Get_estats_worker(id)
+}
+
+func Get_estats_worker_ctx(ctx context.Context, id int) (*Vs_estats_worker_r, error) {
+	return DefaultClient.Get_estats_worker_ctx(ctx, id)
+}
+
+func Get_stats_dev(id int) (*Vs_stats_dev_r, error) {
+	return DefaultClient.Get_stats_dev(id)
+}
+
+func Get_stats_dev_ctx(ctx context.Context, id int) (*Vs_stats_dev_r, error) {
+	return DefaultClient.Get_stats_dev_ctx(ctx, id)
+}
+
+func Get_stats_ctl() (*Vs_stats_ctl_r, error) {
+	return DefaultClient.Get_stats_ctl()
+}
+
+func Get_stats_ctl_ctx(ctx context.Context) (*Vs_stats_ctl_r, error) {
+	return DefaultClient.Get_stats_ctl_ctx(ctx)
+}
+
+func Get_stats_mem() (*Vs_stats_mem_r, error) {
+	return DefaultClient.Get_stats_mem()
+}
+
+func Get_stats_mem_ctx(ctx context.Context) (*Vs_stats_mem_r, error) {
+	return DefaultClient.Get_stats_mem_ctx(ctx)
+}
@@ -0,0 +1,179 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	/* the state of a connection sync daemon */
+	VS_STATE_NONE   = 0x0000
+	VS_STATE_MASTER = 0x0001 /* sends the connections of this node */
+	VS_STATE_BACKUP = 0x0002 /* receives the connections of a master */
+
+	VS_SYNCID_MAX = 255
+)
+
+// Sync_state is master or backup
+type Sync_state int
+
+func (p *Sync_state) Set(value string) error {
+	switch strings.ToLower(value) {
+	case "master":
+		*p = VS_STATE_MASTER
+	case "backup":
+		*p = VS_STATE_BACKUP
+	default:
+		return errSyncState
+	}
+	return nil
+}
+
+func (p Sync_state) String() string {
+	switch p {
+	case VS_STATE_MASTER:
+		return "master"
+	case VS_STATE_BACKUP:
+		return "backup"
+	}
+	return fmt.Sprintf("state %d", int(p))
+}
+
+type Vs_daemon_user struct {
+	State     Sync_state
+	Mcast_ifn string /* multicast interface */
+	Syncid    int    /* the connections of the other sync ids are ignored */
+}
+
+type Vs_daemon_q struct {
+	Cmd    int
+	Daemon Vs_daemon_user
+}
+
+type Vs_daemon_r struct {
+	Code    int
+	Msg     string
+	Daemons []Vs_daemon_user
+}
+
+func Daemon_title() string {
+	return fmt.Sprintf("%-8s %-16s %s", "State", "Mcast_ifn", "Syncid")
+}
+
+func (d Vs_daemon_user) String() string {
+	return fmt.Sprintf("%-8s %-16s %d", d.State, d.Mcast_ifn, d.Syncid)
+}
+
+func (r Vs_daemon_r) String() string {
+	if r.Code != 0 {
+		return errstr(r.Code, r.Msg)
+	}
+	if len(r.Daemons) == 0 {
+		return "no sync daemon"
+	}
+	s := Daemon_title()
+	for _, d := range r.Daemons {
+		s += fmt.Sprintf("\n%s", d)
+	}
+	return s
+}
+
+func daemon_q(cmd int, o *CmdOptions) (Vs_daemon_q, error) {
+	args := Vs_daemon_q{Cmd: cmd, Daemon: Vs_daemon_user{
+		State:     o.Sync_state,
+		Mcast_ifn: o.Mcast_ifn,
+		Syncid:    o.Syncid,
+	}}
+
+	if o.Sync_state != VS_STATE_MASTER && o.Sync_state != VS_STATE_BACKUP {
+		return args, errSyncState
+	}
+	if cmd == VS_CMD_NEW_DAEMON {
+		if o.Mcast_ifn == "" {
+			return args, errMcastIfn
+		}
+		if o.Syncid < 0 || o.Syncid > VS_SYNCID_MAX {
+			return args, errSyncid
+		}
+	}
+	return args, nil
+}
+
+func (c *Client) Start_sync_daemon(o *CmdOptions) (*Vs_cmd_r, error) {
+	return c.Start_sync_daemon_ctx(context.Background(), o)
+}
+
+// Start_sync_daemon_ctx starts the master or backup daemon of
+// o.Sync_state on o.Mcast_ifn
+func (c *Client) Start_sync_daemon_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
+	var reply Vs_cmd_r
+	args, err := daemon_q(VS_CMD_NEW_DAEMON, o)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.call(ctx, "api", args, &reply)
+	return &reply, err
+}
+
+func (c *Client) Stop_sync_daemon(o *CmdOptions) (*Vs_cmd_r, error) {
+	return c.Stop_sync_daemon_ctx(context.Background(), o)
+}
+
+// Stop_sync_daemon_ctx stops the daemon of o.Sync_state
+func (c *Client) Stop_sync_daemon_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
+	var reply Vs_cmd_r
+	args, err := daemon_q(VS_CMD_DEL_DAEMON, o)
+	if err != nil {
+		return nil, err
+	}
+
+	err = c.call(ctx, "api", args, &reply)
+	return &reply, err
+}
+
+func (c *Client) Get_sync_daemon() (*Vs_daemon_r, error) {
+	return c.Get_sync_daemon_ctx(context.Background())
+}
+
+// Get_sync_daemon_ctx lists the running daemons, none, a master, a
+// backup or both
+func (c *Client) Get_sync_daemon_ctx(ctx context.Context) (*Vs_daemon_r, error) {
+	var reply Vs_daemon_r
+	args := Vs_daemon_q{Cmd: VS_CMD_GET_DAEMON}
+
+	err := c.call(ctx, "api", args, &reply)
+	return &reply, err
+}
+
+func Start_sync_daemon(o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Start_sync_daemon(o)
+}
+
+func Start_sync_daemon_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Start_sync_daemon_ctx(ctx, o)
+}
+
+func Stop_sync_daemon(o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Stop_sync_daemon(o)
+}
+
+func Stop_sync_daemon_ctx(ctx context.Context, o *CmdOptions) (*Vs_cmd_r, error) {
+	return DefaultClient.Stop_sync_daemon_ctx(ctx, o)
+}
+
+func Get_sync_daemon() (*Vs_daemon_r, error) {
+	return DefaultClient.Get_sync_daemon()
+}
+
+func Get_sync_daemon_ctx(ctx context.Context) (*Vs_daemon_r, error) {
+	return DefaultClient.Get_sync_daemon_ctx(ctx)
+}
@@ -0,0 +1,187 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs
+
+import (
+	"encoding/json"
+	"net/netip"
+	"strconv"
+)
+
+/*
+ * Be32, Be16, Addr4, Inet_addr and Protocol marshal to text as
+ * "10.0.0.1", "80", "10.0.0.1:80", "[2001:db8::1]:443" and "tcp".
+ * Be32 and Be16 are in the dpvs requests and replies, so their
+ * MarshalJSON keeps the raw number of the wire format, UnmarshalJSON
+ * accepts either form.
+ */
+
+func (p Be32) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Be32) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*p = 0
+		return nil
+	}
+	a, err := netip.ParseAddr(string(text))
+	if err != nil || !a.Is4() {
+		return errIpv4
+	}
+	*p = Netip_be32(a)
+	return nil
+}
+
+func (p Be32) MarshalJSON() ([]byte, error) {
+	return strconv.AppendUint(nil, uint64(p), 10), nil
+}
+
+// dpvs sends a signed int32, govs sends an unsigned one
+func (p *Be32) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		return p.UnmarshalText([]byte(s))
+	}
+
+	var i int64
+	if err := json.Unmarshal(data, &i); err != nil {
+		return err
+	}
+	*p = Be32(uint32(i))
+	return nil
+}
+
+// Netip returns the ipv4 address of p
+func (p Be32) Netip() netip.Addr {
+	u := Ntohl(p)
+	return netip.AddrFrom4([4]byte{byte(u >> 24), byte(u >> 16), byte(u >> 8), byte(u)})
+}
+
+// Netip_be32 converts an ipv4 or ipv4-mapped ipv6 address, any
+// other address is 0.0.0.0
+func Netip_be32(a netip.Addr) Be32 {
+	a = a.Unmap()
+	if !a.Is4() {
+		return 0
+	}
+	b := a.As4()
+	return Htonl(uint32(b[0])<<24 | uint32(b[1])<<16 | uint32(b[2])<<8 | uint32(b[3]))
+}
+
+func (p Be16) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Be16) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*p = 0
+		return nil
+	}
+	n, err := strconv.ParseUint(string(text), 10, 16)
+	if err != nil {
+		return errPort
+	}
+	*p = Htons(uint16(n))
+	return nil
+}
+
+func (p Be16) MarshalJSON() ([]byte, error) {
+	return strconv.AppendUint(nil, uint64(p), 10), nil
+}
+
+func (p *Be16) UnmarshalJSON(data []byte) error {
+	if len(data) > 0 && data[0] == '"' {
+		var s string
+		if err := json.Unmarshal(data, &s); err != nil {
+			return err
+		}
+		return p.UnmarshalText([]byte(s))
+	}
+
+	var i uint16
+	if err := json.Unmarshal(data, &i); err != nil {
+		return err
+	}
+	*p = Be16(i)
+	return nil
+}
+
+func (p Addr4) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Addr4) UnmarshalText(text []byte) error {
+	return p.Set(string(text))
+}
+
+func (p Addr4) Netip() netip.AddrPort {
+	return netip.AddrPortFrom(p.Ip.Netip(), Ntohs(p.Port))
+}
+
+func Netip_addr4(ap netip.AddrPort) Addr4 {
+	return Addr4{Ip: Netip_be32(ap.Addr()), Port: Htons(ap.Port())}
+}
+
+// MarshalText leaves out a zero port, the zero address is ""
+func (p Inet_addr) MarshalText() ([]byte, error) {
+	if p.Is_zero() && p.Port == 0 {
+		return []byte{}, nil
+	}
+	if p.Port == 0 {
+		return []byte(p.Ip_string()), nil
+	}
+	return []byte(p.String()), nil
+}
+
+func (p *Inet_addr) UnmarshalText(text []byte) error {
+	return p.Set(string(text))
+}
+
+func (p Inet_addr) Netip() netip.AddrPort {
+	var a netip.Addr
+	if p.Af == AF_INET6 {
+		a = netip.AddrFrom16(p.Ip6)
+	} else {
+		a = p.Ip.Netip()
+	}
+	return netip.AddrPortFrom(a, Ntohs(p.Port))
+}
+
+// Netip_inet_addr converts ap, ipv4-mapped ipv6 addresses become
+// AF_INET
+func Netip_inet_addr(ap netip.AddrPort) Inet_addr {
+	p := Inet_addr{Port: Htons(ap.Port())}
+	if a := ap.Addr().Unmap(); a.Is4() {
+		p.Af = AF_INET
+		p.Ip = Netip_be32(a)
+	} else {
+		p.Af = AF_INET6
+		p.Ip6 = a.As16()
+	}
+	return p
+}
+
+// MarshalText uses the number of the protocols govs has no name for
+func (p Protocol) MarshalText() ([]byte, error) {
+	if name, ok := protocol_names[uint8(p)]; ok {
+		return []byte(name), nil
+	}
+	return strconv.AppendUint(nil, uint64(p), 10), nil
+}
+
+func (p *Protocol) UnmarshalText(text []byte) error {
+	if n, err := strconv.ParseUint(string(text), 10, 8); err == nil {
+		*p = Protocol(n)
+		return nil
+	}
+	return p.Set(string(text))
+}
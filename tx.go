@@ -0,0 +1,249 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrTxDone = errors.New("govs: transaction has already been committed or rolled back")
+)
+
+// Tx applies service, dest and laddr commands one at a time and
+// records the inverse of each successful one. If a command fails,
+// the commands already applied are undone in reverse order and the
+// Tx is closed.
+//
+// dpvs does not report the nic of services, dests and local
+// addresses, undoing a delete restores them with nic 0.
+type Tx struct {
+	c    *Client
+	undo [][]interface{}
+	done bool
+}
+
+// Tx_error is a failed command of a transaction and the result of
+// the automatic rollback.
+type Tx_error struct {
+	Err      error
+	Rollback error
+}
+
+func (e *Tx_error) Error() string {
+	if e.Rollback != nil {
+		return fmt.Sprintf("%s, rollback failed: %s", e.Err, e.Rollback)
+	}
+	return fmt.Sprintf("%s, rolled back", e.Err)
+}
+
+func (e *Tx_error) Unwrap() error {
+	return e.Err
+}
+
+func (c *Client) Begin() *Tx {
+	return &Tx{c: c}
+}
+
+func Begin() *Tx {
+	return DefaultClient.Begin()
+}
+
+func service_user(svc *Vs_service_user_r) Vs_service_user {
+	return Vs_service_user{
+		Af:          svc.Af,
+		Protocol:    svc.Protocol,
+		Addr:        svc.Addr,
+		Addr6:       svc.Addr6,
+		Port:        svc.Port,
+		Sched_name:  svc.Sched_name,
+		Sched_flags: uint(svc.Sched_flags),
+		Sched_table: svc.Sched_table,
+		Flags:       uint(svc.Flags),
+		Timeout:     uint(svc.Timeout),
+		Netmask:     svc.Netmask,
+	}
+}
+
+func dest_user(d *Vs_dest_user_r) Vs_dest_user {
+	return Vs_dest_user{
+		Af:          d.Af,
+		Addr:        d.Addr,
+		Addr6:       d.Addr6,
+		Port:        d.Port,
+		Conn_flags:  d.Conn_flags,
+		Weight:      d.Weight,
+		U_threshold: d.U_threshold,
+		L_threshold: d.L_threshold,
+	}
+}
+
+func (tx *Tx) exec(ctx context.Context, args interface{}, undo ...interface{}) error {
+	if tx.done {
+		return ErrTxDone
+	}
+
+	var reply Vs_cmd_r
+	if err := tx.c.call(ctx, "api", args, &reply); err != nil {
+		rerr := tx.rollback(context.WithoutCancel(ctx))
+		return &Tx_error{Err: err, Rollback: rerr}
+	}
+	tx.undo = append(tx.undo, undo)
+	return nil
+}
+
+// prior looks up the current state for an undo, a failure aborts
+// the transaction like a failed command.
+func (tx *Tx) prior(ctx context.Context, err error) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	rerr := tx.rollback(context.WithoutCancel(ctx))
+	return &Tx_error{Err: err, Rollback: rerr}
+}
+
+func (tx *Tx) Add_service(ctx context.Context, o *CmdOptions) error {
+	if err := check_sched(o); err != nil {
+		return tx.prior(ctx, err)
+	}
+	return tx.exec(ctx, service_q(VS_CMD_NEW_SERVICE, o),
+		service_q(VS_CMD_DEL_SERVICE, o))
+}
+
+func (tx *Tx) Edit_service(ctx context.Context, o *CmdOptions) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	if err := check_sched(o); err != nil {
+		return tx.prior(ctx, err)
+	}
+	svc, err := tx.c.Get_service_ctx(ctx, o)
+	if err != nil {
+		return tx.prior(ctx, err)
+	}
+
+	return tx.exec(ctx, service_q(VS_CMD_SET_SERVICE, o),
+		Vs_service_q{Cmd: VS_CMD_SET_SERVICE, Service: service_user(&svc.Service)})
+}
+
+// Del_service also records the dests and local addresses of the
+// service, which dpvs deletes with it.
+func (tx *Tx) Del_service(ctx context.Context, o *CmdOptions) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	svc, err := tx.c.Get_service_ctx(ctx, o)
+	if err != nil {
+		return tx.prior(ctx, err)
+	}
+	dests, err := tx.c.Get_dests_ctx(ctx, o)
+	if err != nil {
+		return tx.prior(ctx, err)
+	}
+	laddrs, err := tx.c.Get_laddrs_ctx(ctx, o)
+	if err != nil {
+		return tx.prior(ctx, err)
+	}
+
+	key := service_key(o)
+	undo := []interface{}{
+		Vs_service_q{Cmd: VS_CMD_NEW_SERVICE, Service: service_user(&svc.Service)},
+	}
+	for i := range dests.Dests {
+		undo = append(undo, Vs_dest_q{Cmd: VS_CMD_NEW_DEST,
+			Service: key, Dest: dest_user(&dests.Dests[i])})
+	}
+	for _, l := range laddrs.Laddrs {
+		undo = append(undo, Vs_laddr_q{Cmd: VS_CMD_NEW_LADDR,
+			Service: key, Laddr: Vs_laddr_user{Af: l.Af, Addr: l.Addr, Addr6: l.Addr6}})
+	}
+
+	return tx.exec(ctx, service_q(VS_CMD_DEL_SERVICE, o), undo...)
+}
+
+func (tx *Tx) Add_dest(ctx context.Context, o *CmdOptions) error {
+	return tx.exec(ctx, dest_q(VS_CMD_NEW_DEST, o),
+		dest_q(VS_CMD_DEL_DEST, o))
+}
+
+func (tx *Tx) Edit_dest(ctx context.Context, o *CmdOptions) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	d, err := tx.c.find_dest(ctx, o)
+	if err != nil {
+		return tx.prior(ctx, err)
+	}
+
+	args := dest_q(VS_CMD_SET_DEST, o)
+	keep_fwd(&args, o, d)
+	return tx.exec(ctx, args,
+		Vs_dest_q{Cmd: VS_CMD_SET_DEST, Service: service_key(o), Dest: dest_user(d)})
+}
+
+func (tx *Tx) Del_dest(ctx context.Context, o *CmdOptions) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	d, err := tx.c.find_dest(ctx, o)
+	if err != nil {
+		return tx.prior(ctx, err)
+	}
+
+	return tx.exec(ctx, dest_q(VS_CMD_DEL_DEST, o),
+		Vs_dest_q{Cmd: VS_CMD_NEW_DEST, Service: service_key(o), Dest: dest_user(d)})
+}
+
+func (tx *Tx) Add_laddr(ctx context.Context, o *CmdOptions) error {
+	return tx.exec(ctx, laddr_q(VS_CMD_NEW_LADDR, o),
+		laddr_q(VS_CMD_DEL_LADDR, o))
+}
+
+func (tx *Tx) Del_laddr(ctx context.Context, o *CmdOptions) error {
+	return tx.exec(ctx, laddr_q(VS_CMD_DEL_LADDR, o),
+		laddr_q(VS_CMD_NEW_LADDR, o))
+}
+
+// Commit closes the Tx and keeps its changes.
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	tx.undo = nil
+	return nil
+}
+
+// Rollback undoes every command of the Tx in reverse order and
+// closes it.
+func (tx *Tx) Rollback(ctx context.Context) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	return tx.rollback(ctx)
+}
+
+// rollback keeps going after a failed undo, the first error is
+// returned.
+func (tx *Tx) rollback(ctx context.Context) error {
+	var first error
+
+	tx.done = true
+	for i := len(tx.undo) - 1; i >= 0; i-- {
+		for _, args := range tx.undo[i] {
+			var reply Vs_cmd_r
+			if err := tx.c.call(ctx, "api", args, &reply); err != nil && first == nil {
+				first = err
+			}
+		}
+	}
+	tx.undo = nil
+	return first
+}
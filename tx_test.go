@@ -0,0 +1,166 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/yubo/govs"
+	"github.com/yubo/govs/govstest"
+)
+
+// snapshot is the service of o with its dests and laddrs
+type snapshot struct {
+	Service govs.Vs_service_user_r
+	Dests   []govs.Vs_dest_user_r
+	Laddrs  []govs.Vs_laddr_user_r
+}
+
+func get_snapshot(t *testing.T, c *govs.Client, o *govs.CmdOptions) *snapshot {
+	t.Helper()
+	svc, err := c.Get_service(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dests, err := c.Get_dests(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	laddrs, err := c.Get_laddrs(o)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &snapshot{svc.Service, dests.Dests, laddrs.Laddrs}
+}
+
+// tx_setup adds a persistent service with a laddr, a fullnat and a
+// dr dest
+func tx_setup(t *testing.T) (*govs.Client, *govs.CmdOptions) {
+	t.Helper()
+	c := govstest.NewClient(t)
+	o := options(t, "10.0.0.1:80", "", 0)
+	o.Flags, o.Timeout = govs.VS_SVC_F_PERSISTENT, 300
+	if _, err := c.Set_add(o); err != nil {
+		t.Fatal(err)
+	}
+	lo := *o
+	if err := lo.Lip.Set("192.168.1.100"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Set_addladdr(&lo); err != nil {
+		t.Fatal(err)
+	}
+	fo := options(t, "10.0.0.1:80", "192.168.1.2:8080", 10)
+	fo.Fwd, fo.U_threshold = govs.FWD_FULLNAT, 1000
+	for _, do := range []*govs.CmdOptions{fo, options(t, "10.0.0.1:80", "192.168.1.3:80", 5)} {
+		if _, err := c.Set_adddest(do); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return c, o
+}
+
+// TestTx_del_service fails a command after Del_service, the rollback
+// adds the service back with its dests and laddrs
+func TestTx_del_service(t *testing.T) {
+	ctx := context.Background()
+	c, o := tx_setup(t)
+	before := get_snapshot(t, c, o)
+
+	tx := c.Begin()
+	if err := tx.Del_service(ctx, o); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get_service(o); !errors.Is(err, govs.ErrNotExist) {
+		t.Fatalf("service not deleted, err %v", err)
+	}
+
+	err := tx.Add_dest(ctx, options(t, "10.0.0.1:80", "192.168.1.4:80", 1))
+	var e *govs.Tx_error
+	if !errors.As(err, &e) || e.Rollback != nil || !errors.Is(err, govs.ErrNotExist) {
+		t.Fatalf("err %v, want a rolled back ErrNotExist", err)
+	}
+
+	after := get_snapshot(t, c, o)
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("after rollback\ngot  %+v\nwant %+v", after, before)
+	}
+
+	if err := tx.Add_service(ctx, o); err != govs.ErrTxDone {
+		t.Errorf("Add_service after rollback: %v, want ErrTxDone", err)
+	}
+	if err := tx.Commit(); err != govs.ErrTxDone {
+		t.Errorf("Commit after rollback: %v, want ErrTxDone", err)
+	}
+}
+
+// TestTx_rollback undoes edits, adds and deletes in reverse order
+func TestTx_rollback(t *testing.T) {
+	ctx := context.Background()
+	c, o := tx_setup(t)
+	before := get_snapshot(t, c, o)
+
+	eo := *o
+	eo.Sched_name, eo.Flags, eo.Timeout = "wlc", 0, 0
+	lo := *o
+	if err := lo.Lip.Set("192.168.1.101"); err != nil {
+		t.Fatal(err)
+	}
+	ed := options(t, "10.0.0.1:80", "192.168.1.2:8080", 0)
+	ed.Fwd = govs.FWD_UNSET
+
+	tx := c.Begin()
+	for i, f := range []func() error{
+		func() error { return tx.Edit_service(ctx, &eo) },
+		func() error { return tx.Edit_dest(ctx, ed) },
+		func() error { return tx.Del_dest(ctx, options(t, "10.0.0.1:80", "192.168.1.3:80", 0)) },
+		func() error { return tx.Add_dest(ctx, options(t, "10.0.0.1:80", "192.168.1.4:80", 1)) },
+		func() error { return tx.Add_laddr(ctx, &lo) },
+		func() error { return tx.Del_laddr(ctx, &lo) },
+	} {
+		if err := f(); err != nil {
+			t.Fatalf("command %d: %v", i, err)
+		}
+	}
+	if get_snapshot(t, c, o).Service.Sched_name != "wlc" {
+		t.Fatal("service not edited")
+	}
+
+	if err := tx.Rollback(ctx); err != nil {
+		t.Fatal(err)
+	}
+	after := get_snapshot(t, c, o)
+	if !reflect.DeepEqual(after, before) {
+		t.Errorf("after rollback\ngot  %+v\nwant %+v", after, before)
+	}
+	if err := tx.Rollback(ctx); err != govs.ErrTxDone {
+		t.Errorf("second Rollback: %v, want ErrTxDone", err)
+	}
+}
+
+func TestTx_commit(t *testing.T) {
+	ctx := context.Background()
+	c, o := tx_setup(t)
+
+	tx := c.Begin()
+	if err := tx.Del_service(ctx, o); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Rollback(ctx); err != govs.ErrTxDone {
+		t.Errorf("Rollback after Commit: %v, want ErrTxDone", err)
+	}
+	if _, err := c.Get_service(o); !errors.Is(err, govs.ErrNotExist) {
+		t.Errorf("committed delete undone, err %v", err)
+	}
+}
@@ -65,10 +65,8 @@ func Htons(i uint16) Be16 {
 }
 
 func get_protocol_name(p uint8) string {
-	if p == IPPROTO_TCP {
-		return "tcp"
-	} else if p == IPPROTO_UDP {
-		return "udp"
+	if name, ok := protocol_names[p]; ok {
+		return name
 	}
 	return "unknown"
 }
@@ -76,6 +74,21 @@ func get_protocol_name(p uint8) string {
 func Parse_service(o *CallOptions) error {
 	var addr string
 
+	if o.Opt.ANY != "" {
+		addr = o.Opt.ANY
+		o.Opt.Protocol = IPPROTO_IP
+	}
+
+	if o.Opt.ICMP != "" {
+		addr = o.Opt.ICMP
+		o.Opt.Protocol = IPPROTO_ICMP
+	}
+
+	if o.Opt.SCTP != "" {
+		addr = o.Opt.SCTP
+		o.Opt.Protocol = IPPROTO_SCTP
+	}
+
 	if o.Opt.UDP != "" {
 		addr = o.Opt.UDP
 		o.Opt.Protocol = IPPROTO_UDP
@@ -90,5 +103,9 @@ func Parse_service(o *CallOptions) error {
 		return err
 	}
 
+	if o.Opt.Protocol == IPPROTO_ICMP && o.Opt.Addr.af() == AF_INET6 {
+		o.Opt.Protocol = IPPROTO_ICMPV6
+	}
+
 	return nil
 }
@@ -0,0 +1,84 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func wire_options(t *testing.T, addr, daddr, lip string) *CmdOptions {
+	t.Helper()
+	o := &CmdOptions{Protocol: IPPROTO_TCP, Sched_name: "wrr",
+		Timeout: 300, Weight: 10, Fwd: FWD_DR}
+	for _, a := range []struct {
+		p *Inet_addr
+		s string
+	}{{&o.Addr, addr}, {&o.Daddr, daddr}, {&o.Lip, lip}} {
+		if err := a.p.Set(a.s); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return o
+}
+
+// the ipv4 requests keep the fields and the order of dpvs without
+// ipv6 support
+func TestWire_ipv4(t *testing.T) {
+	o := wire_options(t, "10.0.0.1:80", "192.168.1.2:8080", "192.168.1.100")
+	svc := `{"Nic":0,"Protocol":6,"Addr":16777226,"Port":20480`
+
+	for _, c := range []struct {
+		name string
+		args interface{}
+		want string
+	}{
+		{"service", service_q(VS_CMD_NEW_SERVICE, o), `{"Cmd":1,"Service":` + svc +
+			`,"Sched_name":"wrr","Flags":0,"Timeout":300,"Netmask":0,"Number":0}}`},
+		{"dest", dest_q(VS_CMD_NEW_DEST, o), `{"Cmd":6,"Service":` + svc +
+			`,"Sched_name":"","Flags":0,"Timeout":0,"Netmask":0,"Number":0},` +
+			`"Dest":{"Nic":0,"Addr":33663168,"Port":36895,"Conn_flags":3,` +
+			`"Weight":10,"U_threshold":0,"L_threshold":0}}`},
+		{"laddr", laddr_q(VS_CMD_NEW_LADDR, o), `{"Cmd":19,"Service":` + svc +
+			`,"Sched_name":"","Flags":0,"Timeout":0,"Netmask":0,"Number":0},` +
+			`"Laddr":{"Nic":0,"Addr":1677830336}}`},
+	} {
+		b, err := json.Marshal(c.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != c.want {
+			t.Errorf("%s:\ngot  %s\nwant %s", c.name, b, c.want)
+		}
+	}
+}
+
+func TestWire_ipv6(t *testing.T) {
+	o := wire_options(t, "[2001:db8::1]:443", "[2001:db8::2]:8443", "2001:db8::100")
+
+	for _, c := range []struct {
+		name string
+		args interface{}
+		want []string
+	}{
+		{"service", service_q(VS_CMD_NEW_SERVICE, o), []string{`"Af":10`, `"Addr6":[32,1,13,184,`}},
+		{"dest", dest_q(VS_CMD_NEW_DEST, o), []string{`"Dest":{"Nic":0,"Af":10,"Addr":0,"Addr6":[32,1,13,184,`}},
+		{"laddr", laddr_q(VS_CMD_NEW_LADDR, o), []string{`"Laddr":{"Nic":0,"Af":10,"Addr":0,"Addr6":[32,1,13,184,`}},
+	} {
+		b, err := json.Marshal(c.args)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, w := range c.want {
+			if !strings.Contains(string(b), w) {
+				t.Errorf("%s: %s, want %s", c.name, b, w)
+			}
+		}
+	}
+}
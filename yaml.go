@@ -0,0 +1,90 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+/*
+ * parse_yaml decodes a yaml config with gopkg.in/yaml.v3 into the
+ * tree encoding/json gives, Parse_config then decodes it as json so
+ * the json tags and TextUnmarshalers apply to both formats.
+ */
+
+// yaml_v6_port matches an unquoted [2001:db8::1]:443, a flow
+// sequence followed by a port to yaml
+var yaml_v6_port = regexp.MustCompile(`(^|[:-]\s+)\[[0-9A-Fa-f:.]*\]:[0-9]+\s*(#.*)?$`)
+
+func parse_yaml(data []byte) (interface{}, error) {
+	var tree interface{}
+
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		for i, line := range strings.Split(string(data), "\n") {
+			if yaml_v6_port.MatchString(strings.TrimRight(line, "\r")) {
+				return nil, fmt.Errorf("%w, quote the ipv6 address of line %d, e.g. \"[2001:db8::1]:443\"",
+					err, i+1)
+			}
+		}
+		return nil, err
+	}
+	return tree, nil
+}
+
+// yaml_addr reads back the one item flow sequence yaml makes of an
+// unquoted [2001:db8::1] as the address
+func yaml_addr(v interface{}) interface{} {
+	if seq, ok := v.([]interface{}); ok && len(seq) == 1 {
+		if s, ok := seq[0].(string); ok {
+			return "[" + s + "]"
+		}
+	}
+	return v
+}
+
+// yaml_addrs applies yaml_addr to the addresses of a service
+func yaml_addrs(svc map[string]interface{}) {
+	if addr, ok := svc["addr"]; ok {
+		svc["addr"] = yaml_addr(addr)
+	}
+	if dests, ok := svc["dests"].([]interface{}); ok {
+		for _, d := range dests {
+			if d, ok := d.(map[string]interface{}); ok {
+				if addr, ok := d["addr"]; ok {
+					d["addr"] = yaml_addr(addr)
+				}
+			}
+		}
+	}
+	if laddrs, ok := svc["laddrs"].([]interface{}); ok {
+		for i := range laddrs {
+			laddrs[i] = yaml_addr(laddrs[i])
+		}
+	}
+}
+
+// marshal_yaml writes v with the yaml tags of its fields, the
+// TextMarshalers as scalars
+func marshal_yaml(v interface{}) ([]byte, error) {
+	var b bytes.Buffer
+
+	e := yaml.NewEncoder(&b)
+	e.SetIndent(2)
+	if err := e.Encode(v); err != nil {
+		return nil, err
+	}
+	if err := e.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
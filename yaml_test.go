@@ -0,0 +1,226 @@
+/*
+ * Copyright 2016 Xiaomi Corporation. All rights reserved.
+ * Use of this source code is governed by a BSD-style
+ * license that can be found in the LICENSE file.
+ *
+ * Authors:    Yu Bo <yubo@xiaomi.com>
+ */
+package govs
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func must_addr(t *testing.T, s string) Inet_addr {
+	t.Helper()
+	var a Inet_addr
+	if err := a.Set(s); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestParse_config_yaml(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		in   string
+		want Service_config
+	}{
+		{"quoted v6 addr with port", `
+services:
+  - addr: "[2001:db8::1]:443"
+`, Service_config{Addr: must_addr(t, "[2001:db8::1]:443"), Protocol: IPPROTO_TCP}},
+		{"single quoted v6 addr with port", `
+services:
+  - addr: '[2001:db8::1]:443'
+`, Service_config{Addr: must_addr(t, "[2001:db8::1]:443"), Protocol: IPPROTO_TCP}},
+		{"bracketed v6 addr", `
+services:
+  - addr: [2001:db8::1]
+    dests:
+      - addr: [2001:db8::2]
+        weight: 1
+    laddrs: [[2001:db8::100], 2001:db8::101]
+`, Service_config{Addr: must_addr(t, "2001:db8::1"), Protocol: IPPROTO_TCP,
+			Dests:  []Dest_config{{Addr: must_addr(t, "2001:db8::2"), Weight: 1}},
+			Laddrs: []Inet_addr{must_addr(t, "2001:db8::100"), must_addr(t, "2001:db8::101")}}},
+		{"flow sequences", `
+services:
+  - {addr: 10.0.0.1:80, protocol: udp, laddrs: [192.168.1.100, "192.168.1.101"]}
+`, Service_config{Addr: must_addr(t, "10.0.0.1:80"), Protocol: IPPROTO_UDP,
+			Laddrs: []Inet_addr{must_addr(t, "192.168.1.100"), must_addr(t, "192.168.1.101")}}},
+		{"block laddrs", `
+services:
+  - addr: 10.0.0.1:80
+    laddrs:
+    - 192.168.1.100
+    - "192.168.1.101"
+`, Service_config{Addr: must_addr(t, "10.0.0.1:80"), Protocol: IPPROTO_TCP,
+			Laddrs: []Inet_addr{must_addr(t, "192.168.1.100"), must_addr(t, "192.168.1.101")}}},
+		{"comments", `
+# head
+---
+services:   # the vips
+  - addr: 10.0.0.1:80 # web
+    # sched: wrr
+    sched: "mh" # "maglev"
+`, Service_config{Addr: must_addr(t, "10.0.0.1:80"), Protocol: IPPROTO_TCP, Sched: "mh"}},
+		{"quoting", `
+services:
+  - addr: "10.0.0.1:80"
+    protocol: 'tcp'
+    sched: "wrr"
+    timeout: 300
+    flags: "persistent,synproxy"
+    dests:
+      - addr: '192.168.1.2:8080'
+        weight: 10
+        fwd: "dr"
+`, Service_config{Addr: must_addr(t, "10.0.0.1:80"), Protocol: IPPROTO_TCP,
+			Sched: "wrr", Timeout: 300, Flags: VS_SVC_F_PERSISTENT | VS_SVC_F_SYNPROXY,
+			Dests: []Dest_config{{Addr: must_addr(t, "192.168.1.2:8080"), Weight: 10, Fwd: FWD_DR}}}},
+		{"anchors", `
+services:
+  - addr: 10.0.0.1:80
+    dests:
+      - &rs
+        addr: 192.168.1.2:8080
+        weight: 10
+        fwd: tunnel
+      - <<: *rs
+        addr: 192.168.1.3:8080
+`, Service_config{Addr: must_addr(t, "10.0.0.1:80"), Protocol: IPPROTO_TCP,
+			Dests: []Dest_config{
+				{Addr: must_addr(t, "192.168.1.2:8080"), Weight: 10, Fwd: FWD_TUNNEL},
+				{Addr: must_addr(t, "192.168.1.3:8080"), Weight: 10, Fwd: FWD_TUNNEL}}}},
+	} {
+		cfg, err := Parse_config([]byte(c.in))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if len(cfg.Services) != 1 || !reflect.DeepEqual(cfg.Services[0], c.want) {
+			t.Errorf("%s: got %+v, want %+v", c.name, cfg.Services, c.want)
+		}
+	}
+}
+
+func TestParse_config_yaml_error(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		in   string
+		err  string
+	}{
+		{"unquoted v6 addr with port", "services:\n  - addr: [2001:db8::1]:443",
+			`quote the ipv6 address of line 2, e.g. "[2001:db8::1]:443"`},
+		{"unquoted v6 dest with port", "services:\n  - addr: 10.0.0.1:80\n    dests:\n      - addr: [2001:db8::2]:80 # rs",
+			"quote the ipv6 address of line 4"},
+		{"indent under a scalar", "services:\n  - addr: 10.0.0.1:80\n      weight: 1", "line 3"},
+		{"dedent to no level", "services:\n    - addr: 10.0.0.1:80\n  - addr: 10.0.0.2:80", "line 2"},
+		{"tab indent", "services:\n\t- addr: 10.0.0.1:80", "line 2"},
+		{"duplicate key", "services:\n  - addr: 10.0.0.1:80\n    addr: 10.0.0.2:80", `line 3: mapping key "addr" already defined`},
+		{"open quote", "services:\n  - addr: \"10.0.0.1:80", "yaml"},
+		{"unknown field", "services:\n  - addr: 10.0.0.1:80\n    wieght: 1", "unknown field"},
+		{"bad addr", "services:\n  - addr: 10.0.0.1:x", "syntax error"},
+		{"two item addr", "services:\n  - addr: [2001:db8::1, 2001:db8::2]", "cannot unmarshal array"},
+		{"laddr with port", "services:\n  - addr: 10.0.0.1:80\n    laddrs: [1.1.1.1:80]", "expect an address without port"},
+	} {
+		_, err := Parse_config([]byte(c.in))
+		if err == nil || !strings.Contains(err.Error(), c.err) {
+			t.Errorf("%s: err %v, want %q", c.name, err, c.err)
+		}
+	}
+}
+
+func TestConfig_yaml(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		in   string
+	}{
+		{"v4", `
+# a full service
+services:
+  - addr: 10.0.0.1:80
+    sched: mh            # maglev
+    sched_opts: "mh-table=65537"
+    flags: persistent,synproxy
+    timeout: 300
+    netmask: 255.255.255.0
+    dests:
+      - addr: 192.168.1.2:8080
+        weight: 10
+        fwd: fullnat
+        conn_flags: synproxy
+        u_threshold: 1000
+        l_threshold: 800
+      - addr: 192.168.1.3:8080
+        weight: 0
+        fwd: dr
+    laddrs: [192.168.1.100, '192.168.1.101']
+`},
+		{"v6", `
+services:
+- addr: "[2001:db8::1]:443"
+  protocol: udp
+  dests:
+  - addr: "[2001:db8::2]:8443"
+    weight: 1
+  laddrs: [2001:db8::100, 2001:db8::101]
+- addr: [2001:db8::1]
+  protocol: any
+`},
+		{"empty", "services: []"},
+	} {
+		cfg, err := Parse_config([]byte(c.in))
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		out, err := cfg.Yaml()
+		if err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		cfg2, err := Parse_config(out)
+		if err != nil {
+			t.Errorf("%s: %v\n%s", c.name, err, out)
+			continue
+		}
+		if !reflect.DeepEqual(cfg, cfg2) {
+			t.Errorf("%s: round trip differs\n%s\ngot  %+v\nwant %+v", c.name, out, cfg2, cfg)
+		}
+		if out2, _ := cfg2.Yaml(); string(out2) != string(out) {
+			t.Errorf("%s: yaml not stable\n%s\n%s", c.name, out, out2)
+		}
+	}
+}
+
+func TestConfig_yaml_out(t *testing.T) {
+	cfg := &Config{Services: []Service_config{{
+		Addr:     must_addr(t, "[2001:db8::1]:443"),
+		Protocol: IPPROTO_TCP,
+		Sched:    "wrr",
+		Dests: []Dest_config{{Addr: must_addr(t, "[2001:db8::2]:8443"),
+			Weight: 3, Fwd: FWD_DR}},
+		Laddrs: []Inet_addr{must_addr(t, "2001:db8::100")},
+	}}}
+	want := `services:
+  - addr: '[2001:db8::1]:443'
+    protocol: tcp
+    sched: wrr
+    dests:
+      - addr: '[2001:db8::2]:8443'
+        weight: 3
+        fwd: dr
+    laddrs: ['2001:db8::100']
+`
+	out, err := cfg.Yaml()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != want {
+		t.Errorf("got\n%s\nwant\n%s", out, want)
+	}
+}